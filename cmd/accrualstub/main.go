@@ -0,0 +1,77 @@
+// accrualstub локальная заглушка системы расчёта начислений accrual.
+// Позволяет прогнать полный цикл gophermart без внешнего бинарника:
+//
+//	go run ./cmd/accrualstub -a localhost:8080 -step-delay 2s -auto-register
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/divanov-web/gophermart/internal/accrual/fake"
+	"go.uber.org/zap"
+)
+
+func main() {
+	var (
+		addr      string
+		rules     string
+		tooManyN  int
+		autoReg   bool
+		latency   time.Duration
+		stepDelay time.Duration
+		retry     time.Duration
+	)
+	flag.StringVar(&addr, "a", "localhost:8080", "адрес запуска заглушки accrual")
+	flag.StringVar(&rules, "rules", "Bork:10%,Bosh:7%,LG:500", "правила вознаграждения: match:reward[%],...")
+	flag.DurationVar(&latency, "latency", 0, "задержка каждого ответа")
+	flag.DurationVar(&stepDelay, "step-delay", time.Second, "время в статусах REGISTERED и PROCESSING")
+	flag.IntVar(&tooManyN, "429-every", 0, "отвечать 429 на каждый N-й запрос, 0 — никогда")
+	flag.DurationVar(&retry, "retry-after", 5*time.Second, "значение Retry-After в ответах 429")
+	flag.BoolVar(&autoReg, "auto-register", true, "регистрировать неизвестные заказы со случайным составом при первом запросе")
+	flag.Parse()
+
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		panic(err)
+	}
+	sugar := logger.Sugar()
+	defer func() { _ = logger.Sync() }()
+
+	parsed, err := fake.ParseRules(rules)
+	if err != nil {
+		sugar.Fatalw("bad rules", "rules", rules, "error", err)
+	}
+	cfg := fake.Config{
+		Rules:                parsed,
+		Latency:              latency,
+		StepDelay:            stepDelay,
+		RetryAfter:           retry,
+		TooManyRequestsEvery: tooManyN,
+		AutoRegister:         autoReg,
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	server := &http.Server{
+		Addr:    addr,
+		Handler: fake.NewServer(cfg).Handler(),
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer shutdownCancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	sugar.Infow("Starting accrual stub", "addr", addr, "rules", rules)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		sugar.Fatalw("Accrual stub failed", "error", err)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/divanov-web/gophermart/internal/repository"
+)
+
+const ledgerUsage = "usage: gophermart [flags] ledger reconcile [user-id...]"
+
+// runLedger подкоманда оператора `gophermart ledger reconcile [user-id...]`:
+// восстанавливает кэш balance/withdrawn в users по журналу проводок
+func runLedger(ctx context.Context, ledgerRepo repository.LedgerRepository, args []string) error {
+	if len(args) == 0 || args[0] != "reconcile" {
+		return errors.New(ledgerUsage)
+	}
+
+	if len(args) == 1 {
+		fixed, err := ledgerRepo.ReconcileAll(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("users fixed: %d\n", fixed)
+		return nil
+	}
+
+	for _, arg := range args[1:] {
+		userID, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return fmt.Errorf("bad user id %q: %s", arg, ledgerUsage)
+		}
+		fixed, err := ledgerRepo.Reconcile(ctx, userID)
+		if err != nil {
+			return fmt.Errorf("reconcile user %d: %w", userID, err)
+		}
+		if fixed {
+			fmt.Printf("%d: fixed\n", userID)
+		} else {
+			fmt.Printf("%d: in sync\n", userID)
+		}
+	}
+	return nil
+}
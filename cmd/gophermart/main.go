@@ -2,14 +2,22 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"github.com/divanov-web/gophermart/internal/accrual"
 	"github.com/divanov-web/gophermart/internal/config"
 	"github.com/divanov-web/gophermart/internal/handlers"
+	"github.com/divanov-web/gophermart/internal/keyring"
+	"github.com/divanov-web/gophermart/internal/leader"
 	"github.com/divanov-web/gophermart/internal/middleware"
+	"github.com/divanov-web/gophermart/internal/migrations"
 	"github.com/divanov-web/gophermart/internal/repository"
 	"github.com/divanov-web/gophermart/internal/service"
 	"go.uber.org/zap"
 	"net/http"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 )
 
@@ -32,27 +40,130 @@ func main() {
 		}
 	}()
 
-	//context
-	ctx, cancel := context.WithCancel(context.Background())
+	// контекст отменяется по SIGINT/SIGTERM и останавливает фоновые воркеры
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
-	_ = ctx
 
 	gormDB, err := repository.InitDB(cfg.DatabaseDSN)
 	if err != nil {
 		sugar.Fatalw("failed to initialize database", "error", err)
 	}
 
+	sqlDB, err := gormDB.DB()
+	if err != nil {
+		sugar.Fatalw("failed to get database handle", "error", err)
+	}
+	migrator, err := migrations.NewMigrator(sqlDB, sugar)
+	if err != nil {
+		sugar.Fatalw("failed to load migrations", "error", err)
+	}
+
+	// gophermart migrate up|down|status — только работа со схемой, без запуска сервера
+	if args := flag.Args(); len(args) > 0 && args[0] == "migrate" {
+		if err := runMigrate(ctx, migrator, args[1:]); err != nil {
+			sugar.Fatalw("migrate failed", "error", err)
+		}
+		return
+	}
+
+	if cfg.SchemaCheckOnly {
+		if err := migrator.Check(ctx); err != nil {
+			sugar.Fatalw("database schema check failed", "error", err)
+		}
+	} else if _, err := migrator.Up(ctx); err != nil {
+		sugar.Fatalw("failed to migrate database", "error", err)
+	}
+
 	userRepo := repository.NewUserRepository(gormDB)
 	userService := service.NewUserService(userRepo)
+	tokenRepo := repository.NewTokenRepository(gormDB)
+	sessionRepo := repository.NewSessionRepository(gormDB)
+
+	// ключи подписи JWT: файл со связкой ключей или единственный AUTH_SECRET
+	keys := keyring.NewStatic(cfg.AuthSecret)
+	if cfg.AuthKeysFile == "" {
+		if err := keyring.ValidateSecret(cfg.AuthSecret); err != nil {
+			// секрет по умолчанию годится только для разработки: токены можно подделать, подобрав его
+			sugar.Warnw("Weak AUTH_SECRET, set a random secret of at least 32 bytes or AUTH_KEYS_FILE", "error", err)
+		}
+	} else {
+		keys, err = keyring.Load(cfg.AuthKeysFile, sugar)
+		if err != nil {
+			sugar.Fatalw("failed to load JWT keys", "error", err)
+		}
+		sugar.Infow("JWT keys loaded", "file", cfg.AuthKeysFile, "active", keys.ActiveKeyID())
+	}
+	authService := service.NewAuthService(tokenRepo, sessionRepo, keys, sugar, cfg)
 
 	orderRepo := repository.NewOrderRepository(gormDB)
 	orderService := service.NewOrderService(orderRepo, userRepo, sugar, cfg)
 
-	h := handlers.NewHandler(userService, orderService, sugar, cfg)
+	// gophermart orders stuck|requeue — разбор зависших заказов оператором
+	if args := flag.Args(); len(args) > 0 && args[0] == "orders" {
+		if err := runOrders(ctx, orderService, args[1:]); err != nil {
+			sugar.Fatalw("orders command failed", "error", err)
+		}
+		return
+	}
+
+	// gophermart ledger reconcile — восстановление кэша баланса по журналу проводок
+	if args := flag.Args(); len(args) > 0 && args[0] == "ledger" {
+		if err := runLedger(ctx, repository.NewLedgerRepository(gormDB), args[1:]); err != nil {
+			sugar.Fatalw("ledger command failed", "error", err)
+		}
+		return
+	}
+
+	idempotencyRepo := repository.NewIdempotencyRepository(gormDB)
+	idempotencyService := service.NewIdempotencyService(idempotencyRepo, cfg.IdempotencyKeyTTL, cfg.IdempotencyLockTimeout, sugar)
+
+	accrualOptions := accrual.DefaultOptions()
+	if cfg.AccrualRequestTimeout > 0 {
+		accrualOptions.RequestTimeout = cfg.AccrualRequestTimeout
+	}
+	if cfg.AccrualMaxIdleConns > 0 {
+		accrualOptions.MaxIdleConns = cfg.AccrualMaxIdleConns
+		accrualOptions.MaxIdleConnsPerHost = cfg.AccrualMaxIdleConns
+	}
+	if cfg.AccrualKeepAlive > 0 {
+		accrualOptions.KeepAlive = cfg.AccrualKeepAlive
+	}
+	accrualOptions.TLSCAFile = cfg.AccrualTLSCAFile
+	accrualOptions.TLSInsecureSkipVerify = cfg.AccrualTLSInsecure
+
+	accrualClient, err := accrual.NewClientWithOptions(cfg.AccrualAddress, accrualOptions, sugar)
+	if err != nil {
+		sugar.Fatalw("failed to create accrual client", "error", err)
+	}
+	accrualBreaker := accrual.NewBreaker(accrual.BreakerConfig{
+		FailureThreshold: cfg.AccrualBreakerFailures,
+		Cooldown:         cfg.AccrualBreakerCooldown,
+		HalfOpenProbes:   cfg.AccrualBreakerProbes,
+	}, sugar)
+	accrualProvider := accrual.WithBreaker(accrualClient, accrualBreaker)
+
+	// задачи-одиночки работают только на реплике-лидере
+	elector := leader.New(sqlDB, "jobs", leader.JobsKey, cfg.LeaderElectionInterval, sugar)
 
-	accrualClient := accrual.NewClient(cfg.AccrualAddress, sugar)
-	orderService.StartOrderSenderWorker(ctx, 3*time.Second, accrualClient)
-	orderService.StartAccrualUpdaterWorker(ctx, 5*time.Second, accrualClient)
+	h := handlers.NewHandler(userService, authService, keys, orderService, idempotencyService, accrualBreaker, elector, sugar, cfg)
+
+	var workers sync.WaitGroup
+	keys.StartReloadWorker(ctx, &workers, cfg.AuthKeysReload)
+	orderService.StartOrderSenderWorker(ctx, &workers, 3*time.Second, accrualProvider)
+	// с callback-ом опрос accrual остаётся редким резервным проходом
+	pollInterval := 5 * time.Second
+	if cfg.AccrualCallbackSecret != "" {
+		pollInterval = cfg.AccrualFallbackPoll
+	}
+	orderService.StartAccrualUpdaterWorker(ctx, &workers, pollInterval, accrualProvider)
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		elector.Run(ctx, func(ctx context.Context, wg *sync.WaitGroup) {
+			idempotencyService.StartCleanupWorker(ctx, wg, time.Hour)
+			authService.StartCleanupWorker(ctx, wg, time.Hour)
+		})
+	}()
 
 	sugar.Infow(
 		"Starting server",
@@ -64,8 +175,70 @@ func main() {
 		"DatabaseDSN", cfg.DatabaseDSN,
 	)
 
-	if err := http.ListenAndServe(cfg.ServerAddress, h.Router); err != nil {
-		sugar.Fatalw("Server failed", "error", err)
+	server := &http.Server{
+		Addr:    cfg.ServerAddress,
+		Handler: h.Router,
+	}
+
+	serverErr := make(chan error, 2)
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
+
+	// метрики слушают отдельный адрес, закрытый от клиентов
+	var metricsServer *http.Server
+	if cfg.MetricsAddress != "" {
+		metricsServer = &http.Server{
+			Addr:    cfg.MetricsAddress,
+			Handler: handlers.NewMetricsHandler(),
+		}
+		sugar.Infow("Starting metrics server", "addr", cfg.MetricsAddress)
+		go func() {
+			if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				serverErr <- err
+			}
+		}()
+	}
+
+	select {
+	case <-ctx.Done():
+		sugar.Infow("Shutdown signal received", "timeout", cfg.ShutdownTimeout)
+	case err := <-serverErr:
+		sugar.Errorw("Server failed", "error", err)
+	}
+	// останавливаем воркеры и в случае падения сервера
+	cancel()
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer shutdownCancel()
+
+	// дожидаемся завершения текущих HTTP-запросов
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		sugar.Errorw("HTTP server shutdown failed", "error", err)
+	}
+	if metricsServer != nil {
+		if err := metricsServer.Shutdown(shutdownCtx); err != nil {
+			sugar.Errorw("Metrics server shutdown failed", "error", err)
+		}
+	}
+
+	// дожидаемся воркеров, чтобы не закрыть пул соединений посреди записи
+	workersDone := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(workersDone)
+	}()
+	select {
+	case <-workersDone:
+	case <-shutdownCtx.Done():
+		sugar.Errorw("Background workers did not stop in time", "timeout", cfg.ShutdownTimeout)
+	}
+
+	if err := sqlDB.Close(); err != nil {
+		sugar.Errorw("Failed to close database", "error", err)
 	}
 
+	sugar.Infow("Server stopped")
 }
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/divanov-web/gophermart/internal/service"
+)
+
+const ordersUsage = "usage: gophermart [flags] orders stuck|requeue <number>..."
+
+// runOrders подкоманда оператора `gophermart orders stuck|requeue <number>...`
+func runOrders(ctx context.Context, orderService *service.OrderService, args []string) error {
+	if len(args) == 0 {
+		return errors.New(ordersUsage)
+	}
+
+	switch args[0] {
+	case "stuck":
+		orders, err := orderService.ListStuckOrders(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NUMBER\tUSER\tATTEMPTS\tUPLOADED AT\tLAST ERROR")
+		for _, o := range orders {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\n", o.Number, o.UserID, o.Attempts, o.CreatedAt.Format(time.RFC3339), o.LastError)
+		}
+		return w.Flush()
+	case "requeue":
+		if len(args) < 2 {
+			return fmt.Errorf("no order numbers: %s", ordersUsage)
+		}
+		for _, number := range args[1:] {
+			err := orderService.RequeueOrder(ctx, number)
+			if errors.Is(err, service.ErrOrderNotStuck) {
+				fmt.Printf("%s: not stuck, skipped\n", number)
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("requeue %s: %w", number, err)
+			}
+			fmt.Printf("%s: requeued\n", number)
+		}
+	default:
+		return fmt.Errorf("unknown orders command %q: %s", args[0], ordersUsage)
+	}
+	return nil
+}
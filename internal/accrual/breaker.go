@@ -0,0 +1,233 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrCircuitOpen запрос не отправлен: accrual недоступен и автомат разомкнут
+var ErrCircuitOpen = errors.New("accrual circuit breaker is open")
+
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"
+	BreakerOpen     BreakerState = "open"
+	BreakerHalfOpen BreakerState = "half-open"
+)
+
+type BreakerConfig struct {
+	FailureThreshold int           // подряд идущих ошибок до размыкания
+	Cooldown         time.Duration // сколько автомат разомкнут до пробных запросов
+	HalfOpenProbes   int           // одновременных пробных запросов в half-open; успех всех замыкает автомат
+}
+
+// Breaker автомат защиты обращений к accrual: closed → open после FailureThreshold ошибок подряд,
+// open → half-open по истечении Cooldown, half-open → closed после успешных проб или снова open при ошибке
+type Breaker struct {
+	mu        sync.Mutex
+	cfg       BreakerConfig
+	state     BreakerState
+	failures  int
+	openedAt  time.Time
+	probes    int // пробных запросов в полёте
+	successes int // успешных проб в текущем half-open
+	logger    *zap.SugaredLogger
+	now       func() time.Time
+}
+
+func NewBreaker(cfg BreakerConfig, logger *zap.SugaredLogger) *Breaker {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 5
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = 30 * time.Second
+	}
+	if cfg.HalfOpenProbes <= 0 {
+		cfg.HalfOpenProbes = 1
+	}
+	return &Breaker{
+		cfg:    cfg,
+		state:  BreakerClosed,
+		logger: logger,
+		now:    time.Now,
+	}
+}
+
+// State текущее состояние с учётом истёкшего Cooldown
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen && b.now().Sub(b.openedAt) >= b.cfg.Cooldown {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+// Allow можно ли отправить запрос. В half-open пропускает не больше HalfOpenProbes запросов
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.cfg.Cooldown {
+			return false
+		}
+		b.setState(BreakerHalfOpen)
+		fallthrough
+	case BreakerHalfOpen:
+		if b.probes >= b.cfg.HalfOpenProbes {
+			return false
+		}
+		b.probes++
+		return true
+	default:
+		return true
+	}
+}
+
+// Success учитывает успешный ответ accrual
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	if b.state != BreakerHalfOpen {
+		return
+	}
+	b.probes--
+	b.successes++
+	if b.successes >= b.cfg.HalfOpenProbes {
+		b.setState(BreakerClosed)
+	}
+}
+
+// Failure учитывает недоступность accrual
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerHalfOpen:
+		b.probes--
+		b.open()
+	case BreakerClosed:
+		b.failures++
+		if b.failures >= b.cfg.FailureThreshold {
+			b.open()
+		}
+	}
+}
+
+// Release отменённый вызывающим запрос: ни успех, ни ошибка, но занятую пробу нужно вернуть
+func (b *Breaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+func (b *Breaker) open() {
+	b.openedAt = b.now()
+	b.setState(BreakerOpen)
+}
+
+func (b *Breaker) setState(state BreakerState) {
+	if b.state == state {
+		return
+	}
+	from := b.state
+	b.state = state
+	b.failures = 0
+	b.successes = 0
+	if state != BreakerHalfOpen {
+		b.probes = 0
+	}
+
+	if b.logger == nil {
+		return
+	}
+	switch state {
+	case BreakerOpen:
+		b.logger.Warnw("Accrual circuit breaker opened", "from", from, "cooldown", b.cfg.Cooldown)
+	default:
+		b.logger.Infow("Accrual circuit breaker state changed", "from", from, "to", state)
+	}
+}
+
+// Availability необязательный интерфейс AccrualProvider: воркеры пропускают проход целиком, пока accrual недоступен
+type Availability interface {
+	Available() bool
+}
+
+// BreakerProvider AccrualProvider, защищённый автоматом
+type BreakerProvider struct {
+	next    AccrualProvider
+	breaker *Breaker
+}
+
+func WithBreaker(next AccrualProvider, breaker *Breaker) *BreakerProvider {
+	return &BreakerProvider{next: next, breaker: breaker}
+}
+
+func (p *BreakerProvider) Available() bool {
+	return p.breaker.State() != BreakerOpen
+}
+
+func (p *BreakerProvider) SendOrder(ctx context.Context, orderNumber string) error {
+	if !p.breaker.Allow() {
+		return ErrCircuitOpen
+	}
+	err := p.next.SendOrder(ctx, orderNumber)
+	p.record(ctx, err)
+	return err
+}
+
+func (p *BreakerProvider) GetOrderInfo(ctx context.Context, orderNumber string) (*AccrualResponse, error) {
+	if !p.breaker.Allow() {
+		return nil, ErrCircuitOpen
+	}
+	resp, err := p.next.GetOrderInfo(ctx, orderNumber)
+	p.record(ctx, err)
+	return resp, err
+}
+
+// record отмена контекста вызывающим ничего не говорит о доступности accrual
+func (p *BreakerProvider) record(ctx context.Context, err error) {
+	switch {
+	case ctx.Err() != nil:
+		p.breaker.Release()
+	case unavailable(err):
+		p.breaker.Failure()
+	default:
+		p.breaker.Success()
+	}
+}
+
+// unavailable ошибки, означающие недоступность accrual: сеть, таймаут, 5xx.
+// 4xx, 429, неразборчивое тело или неизвестный статус — ответ живого сервиса про конкретный заказ,
+// и автомат из-за них размыкаться не должен
+func unavailable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Code >= http.StatusInternalServerError
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
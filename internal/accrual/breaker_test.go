@@ -0,0 +1,93 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type stubProvider struct {
+	err error
+}
+
+func (p *stubProvider) SendOrder(ctx context.Context, orderNumber string) error {
+	return p.err
+}
+
+func (p *stubProvider) GetOrderInfo(ctx context.Context, orderNumber string) (*AccrualResponse, error) {
+	return nil, p.err
+}
+
+func TestBreaker_Transitions(t *testing.T) {
+	now := time.Now()
+	b := NewBreaker(BreakerConfig{FailureThreshold: 2, Cooldown: time.Minute, HalfOpenProbes: 1}, zap.NewNop().Sugar())
+	b.now = func() time.Time { return now }
+
+	stub := &stubProvider{err: &url.Error{Op: "Get", URL: "http://accrual/api/orders/1", Err: errors.New("connection refused")}}
+	p := WithBreaker(stub, b)
+	ctx := context.Background()
+
+	_, _ = p.GetOrderInfo(ctx, "1")
+	assert.Equal(t, BreakerClosed, b.State())
+	_, _ = p.GetOrderInfo(ctx, "1")
+	assert.Equal(t, BreakerOpen, b.State())
+	assert.False(t, p.Available())
+
+	_, err := p.GetOrderInfo(ctx, "1")
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+
+	// после cooldown пробный запрос с ошибкой снова размыкает автомат
+	now = now.Add(time.Minute)
+	assert.True(t, p.Available())
+	_, err = p.GetOrderInfo(ctx, "1")
+	assert.NotErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, BreakerOpen, b.State())
+
+	// успешная проба замыкает
+	now = now.Add(time.Minute)
+	stub.err = nil
+	assert.True(t, b.Allow())
+	assert.False(t, b.Allow(), "only one probe in half-open")
+	b.Success()
+	assert.Equal(t, BreakerClosed, b.State())
+}
+
+func TestBreaker_RateLimitIsNotFailure(t *testing.T) {
+	b := NewBreaker(BreakerConfig{FailureThreshold: 1}, zap.NewNop().Sugar())
+	p := WithBreaker(&stubProvider{err: &RateLimitError{RetryAfter: time.Second}}, b)
+
+	_, _ = p.GetOrderInfo(context.Background(), "1")
+	assert.Equal(t, BreakerClosed, b.State())
+}
+
+func TestBreakerProvider_CountsOnlyUnavailability(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		wantOpen bool
+	}{
+		{name: "transport error", err: &url.Error{Op: "Get", URL: "http://accrual", Err: errors.New("connection refused")}, wantOpen: true},
+		{name: "request timeout", err: fmt.Errorf("accrual status request failed: %w", context.DeadlineExceeded), wantOpen: true},
+		{name: "5xx", err: &StatusError{Code: http.StatusBadGateway, Status: "502 Bad Gateway"}, wantOpen: true},
+		{name: "4xx for one order", err: &StatusError{Code: http.StatusBadRequest, Status: "400 Bad Request"}},
+		{name: "bad payload", err: fmt.Errorf("decode accrual response: %w", errors.New("invalid character"))},
+		{name: "unknown status", err: fmt.Errorf("%w: %q", ErrUnknownStatus, "DONE")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBreaker(BreakerConfig{FailureThreshold: 1, Cooldown: time.Minute}, zap.NewNop().Sugar())
+			p := WithBreaker(&stubProvider{err: tt.err}, b)
+
+			_, _ = p.GetOrderInfo(context.Background(), "1")
+			assert.Equal(t, tt.wantOpen, b.State() == BreakerOpen)
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package accrual
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Заголовки callback-запроса accrual. Подпись — HMAC-SHA256 от "<timestamp>.<тело>"
+// в виде "sha256=<hex>", timestamp — unix-время отправки в секундах
+const (
+	SignatureHeader = "X-Accrual-Signature"
+	TimestampHeader = "X-Accrual-Timestamp"
+
+	signaturePrefix = "sha256="
+)
+
+// DefaultCallbackTolerance допустимое расхождение времени подписи, защищает от повтора старых запросов
+const DefaultCallbackTolerance = 5 * time.Minute
+
+var (
+	ErrBadSignature     = errors.New("bad accrual callback signature")
+	ErrStaleCallback    = errors.New("accrual callback timestamp out of tolerance")
+	ErrMissingSignature = errors.New("accrual callback is not signed")
+)
+
+// SignCallback подпись тела callback-запроса, отправленного в момент ts
+func SignCallback(secret []byte, ts time.Time, body []byte) string {
+	return signaturePrefix + hex.EncodeToString(callbackMAC(secret, strconv.FormatInt(ts.Unix(), 10), body))
+}
+
+// VerifyCallback проверяет подпись и свежесть callback-запроса по значениям его заголовков
+func VerifyCallback(secret []byte, timestamp, signature string, body []byte, now time.Time, tolerance time.Duration) error {
+	if timestamp == "" || signature == "" {
+		return ErrMissingSignature
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrBadSignature
+	}
+	if d := now.Sub(time.Unix(unix, 0)); d > tolerance || d < -tolerance {
+		return ErrStaleCallback
+	}
+
+	sig, err := hex.DecodeString(strings.TrimPrefix(signature, signaturePrefix))
+	if err != nil || !strings.HasPrefix(signature, signaturePrefix) {
+		return ErrBadSignature
+	}
+	if !hmac.Equal(sig, callbackMAC(secret, timestamp, body)) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+func callbackMAC(secret []byte, timestamp string, body []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
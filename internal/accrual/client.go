@@ -2,29 +2,110 @@ package accrual
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"github.com/divanov-web/gophermart/internal/model"
 	"github.com/divanov-web/gophermart/internal/utils/ordergen"
 	"go.uber.org/zap"
+	"net"
 	"net/http"
+	"os"
 	"time"
 )
 
+// AccrualProvider система расчёта начислений, с которой работают воркеры OrderService
+type AccrualProvider interface {
+	SendOrder(ctx context.Context, orderNumber string) error
+	GetOrderInfo(ctx context.Context, orderNumber string) (*AccrualResponse, error)
+}
+
 type Client struct {
-	BaseURL    string
-	HTTPClient *http.Client
-	logger     *zap.SugaredLogger
+	BaseURL        string
+	HTTPClient     *http.Client
+	requestTimeout time.Duration
+	logger         *zap.SugaredLogger
+}
+
+// Options настройки запросов и HTTP-транспорта клиента accrual
+type Options struct {
+	RequestTimeout      time.Duration // таймаут одного запроса поверх контекста вызывающего
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+	KeepAlive           time.Duration
+	DialTimeout         time.Duration
+
+	TLSCAFile             string // PEM с корневыми сертификатами accrual, пусто — системные
+	TLSInsecureSkipVerify bool   // только для локальной разработки
+}
+
+func DefaultOptions() Options {
+	return Options{
+		RequestTimeout:      10 * time.Second,
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 16,
+		IdleConnTimeout:     90 * time.Second,
+		KeepAlive:           30 * time.Second,
+		DialTimeout:         5 * time.Second,
+	}
 }
 
 func NewClient(baseURL string, logger *zap.SugaredLogger) *Client {
+	// настройки по умолчанию не читают файлов, ошибки быть не может
+	c, _ := NewClientWithOptions(baseURL, DefaultOptions(), logger)
+	return c
+}
+
+// NewClientWithOptions клиент с настраиваемыми таймаутами, пулом соединений и TLS
+func NewClientWithOptions(baseURL string, opts Options, logger *zap.SugaredLogger) (*Client, error) {
+	defaults := DefaultOptions()
+	if opts.RequestTimeout <= 0 {
+		opts.RequestTimeout = defaults.RequestTimeout
+	}
+	if opts.DialTimeout <= 0 {
+		opts.DialTimeout = defaults.DialTimeout
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: opts.TLSInsecureSkipVerify, // включается явно, только для локальной разработки
+	}
+	if opts.TLSCAFile != "" {
+		pem, err := os.ReadFile(opts.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read accrual CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in accrual CA file %s", opts.TLSCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   opts.DialTimeout,
+			KeepAlive: opts.KeepAlive,
+		}).DialContext,
+		MaxIdleConns:        opts.MaxIdleConns,
+		MaxIdleConnsPerHost: opts.MaxIdleConnsPerHost,
+		IdleConnTimeout:     opts.IdleConnTimeout,
+		TLSHandshakeTimeout: opts.DialTimeout,
+		TLSClientConfig:     tlsConfig,
+		ForceAttemptHTTP2:   true,
+	}
+
 	return &Client{
 		BaseURL: baseURL,
-		HTTPClient: &http.Client{
-			Timeout: 10 * time.Second,
-		},
-		logger: logger,
-	}
+		// общий таймаут не задаём: время запроса ограничивает контекст с requestTimeout
+		HTTPClient:     &http.Client{Transport: transport},
+		requestTimeout: opts.RequestTimeout,
+		logger:         logger,
+	}, nil
 }
 
 type AccrualRequest struct {
@@ -33,13 +114,13 @@ type AccrualRequest struct {
 }
 
 type AccrualResponse struct {
-	Order   string   `json:"order"`
-	Status  string   `json:"status"`
-	Accrual *float64 `json:"accrual,omitempty"`
+	Order   string        `json:"order"`
+	Status  AccrualStatus `json:"status"`
+	Accrual *model.Money  `json:"accrual,omitempty"`
 }
 
 // SendOrder Отправка нового заказа на сервер accrual
-func (c *Client) SendOrder(orderNumber string) error {
+func (c *Client) SendOrder(ctx context.Context, orderNumber string) error {
 	reqBody := AccrualRequest{
 		Order: orderNumber,
 		Goods: ordergen.GenerateRandomGoods(),
@@ -50,8 +131,11 @@ func (c *Client) SendOrder(orderNumber string) error {
 		return fmt.Errorf("marshal accrual request: %w", err)
 	}
 
+	ctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+	defer cancel()
+
 	url := fmt.Sprintf("%s/api/orders", c.BaseURL)
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
 	if err != nil {
 		return fmt.Errorf("build accrual request: %w", err)
 	}
@@ -74,15 +158,32 @@ func (c *Client) SendOrder(orderNumber string) error {
 		return nil
 	case http.StatusConflict:
 		return nil
+	case http.StatusTooManyRequests:
+		return newRateLimitError(resp)
 	default:
-		return fmt.Errorf("unexpected status from accrual: %s", resp.Status)
+		return &StatusError{Code: resp.StatusCode, Status: resp.Status}
 	}
 }
 
-func (c *Client) GetOrderInfo(orderNumber string) (*AccrualResponse, error) {
+// StatusError неожиданный HTTP-статус ответа accrual
+type StatusError struct {
+	Code   int
+	Status string
+}
+
+func (e *StatusError) Error() string {
+	return "unexpected status from accrual: " + e.Status
+}
+
+// GetOrderInfo Получение статуса расчёта начисления по заказу.
+// При ответе 429 возвращает *RateLimitError
+func (c *Client) GetOrderInfo(ctx context.Context, orderNumber string) (*AccrualResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+	defer cancel()
+
 	url := fmt.Sprintf("%s/api/orders/%s", c.BaseURL, orderNumber)
 
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("build accrual status request: %w", err)
 	}
@@ -97,8 +198,12 @@ func (c *Client) GetOrderInfo(orderNumber string) (*AccrualResponse, error) {
 		return nil, nil // заказ не зарегистрирован
 	}
 
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, newRateLimitError(resp)
+	}
+
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status from accrual: %s", resp.Status)
+		return nil, &StatusError{Code: resp.StatusCode, Status: resp.Status}
 	}
 
 	var result AccrualResponse
@@ -106,6 +211,10 @@ func (c *Client) GetOrderInfo(orderNumber string) (*AccrualResponse, error) {
 	if err != nil {
 		return nil, fmt.Errorf("decode accrual response: %w", err)
 	}
+	// UnmarshalJSON статуса не вызывается, если поля status в ответе нет
+	if _, err := ParseAccrualStatus(string(result.Status)); err != nil {
+		return nil, err
+	}
 
 	return &result, nil
 }
@@ -0,0 +1,145 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestGetOrderInfo_RateLimited(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter string
+		want       time.Duration
+	}{
+		{name: "seconds", retryAfter: "7", want: 7 * time.Second},
+		{name: "missing header", retryAfter: "", want: DefaultRetryAfter},
+		{name: "garbage", retryAfter: "soon", want: DefaultRetryAfter},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				http.Error(w, "No more than N requests per minute allowed", http.StatusTooManyRequests)
+			}))
+			defer srv.Close()
+
+			client := NewClient(srv.URL, zap.NewNop().Sugar())
+			resp, err := client.GetOrderInfo(context.Background(), "79927398713")
+
+			assert.Nil(t, resp)
+			assert.ErrorIs(t, err, ErrRateLimited)
+			var rateErr *RateLimitError
+			require.True(t, errors.As(err, &rateErr))
+			assert.Equal(t, tt.want, rateErr.RetryAfter)
+		})
+	}
+}
+
+func TestParseRetryAfter_HTTPDate(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	value := now.Add(90 * time.Second).Format(http.TimeFormat)
+
+	assert.Equal(t, 90*time.Second, parseRetryAfter(value, now))
+}
+
+func TestPause_DoesNotShorten(t *testing.T) {
+	p := NewPause()
+	assert.Zero(t, p.Remaining())
+
+	p.Set(time.Minute)
+	p.Set(time.Second)
+
+	assert.Greater(t, p.Remaining(), 30*time.Second)
+}
+
+func TestGetOrderInfo_RequestTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+
+	opts := DefaultOptions()
+	opts.RequestTimeout = 50 * time.Millisecond
+	client, err := NewClientWithOptions(srv.URL, opts, zap.NewNop().Sugar())
+	require.NoError(t, err)
+
+	start := time.Now()
+	_, err = client.GetOrderInfo(context.Background(), "79927398713")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+}
+
+func TestSendOrder_ContextCancel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+
+	client := NewClient(srv.URL, zap.NewNop().Sugar())
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	err := client.SendOrder(ctx, "79927398713")
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestNewClientWithOptions_BadCAFile(t *testing.T) {
+	opts := DefaultOptions()
+	opts.TLSCAFile = "/nonexistent/ca.pem"
+
+	_, err := NewClientWithOptions("https://accrual", opts, zap.NewNop().Sugar())
+	assert.Error(t, err)
+}
+
+func TestGetOrderInfo_Statuses(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    AccrualStatus
+		wantErr error
+	}{
+		{name: "registered", body: `{"order":"1","status":"REGISTERED"}`, want: StatusRegistered},
+		{name: "processed", body: `{"order":"1","status":"PROCESSED","accrual":10}`, want: StatusProcessed},
+		{name: "unknown", body: `{"order":"1","status":"DONE"}`, wantErr: ErrUnknownStatus},
+		{name: "lower case is not accepted", body: `{"order":"1","status":"processed"}`, wantErr: ErrUnknownStatus},
+		{name: "not a string", body: `{"order":"1","status":1}`, wantErr: ErrUnknownStatus},
+		{name: "missing status", body: `{"order":"1"}`, wantErr: ErrUnknownStatus},
+		{name: "null status", body: `{"order":"1","status":null}`, wantErr: ErrUnknownStatus},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = io.WriteString(w, tt.body)
+			}))
+			defer srv.Close()
+
+			resp, err := NewClient(srv.URL, zap.NewNop().Sugar()).GetOrderInfo(context.Background(), "1")
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, resp.Status)
+		})
+	}
+}
@@ -0,0 +1,281 @@
+// Package fake встроенная заглушка системы расчёта начислений accrual для локальной разработки и тестов.
+// Реализует POST /api/goods, POST /api/orders и GET /api/orders/{number} с настраиваемыми
+// правилами вознаграждения, задержкой ответов, искусственными 429 и сменой статусов заказа
+package fake
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/divanov-web/gophermart/internal/accrual"
+	"github.com/divanov-web/gophermart/internal/model"
+	"github.com/divanov-web/gophermart/internal/utils"
+	"github.com/divanov-web/gophermart/internal/utils/ordergen"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	RewardPercent = "%"
+	RewardPoints  = "pt"
+)
+
+var ErrBadRule = errors.New("bad reward rule")
+
+// Rule правило вознаграждения: товар, в описании которого встречается Match,
+// приносит Reward процентов от цены или Reward баллов
+type Rule struct {
+	Match      string      `json:"match"`
+	Reward     model.Money `json:"reward"`
+	RewardType string      `json:"reward_type"`
+}
+
+func (r Rule) validate() error {
+	if strings.TrimSpace(r.Match) == "" || r.Reward <= 0 {
+		return ErrBadRule
+	}
+	if r.RewardType != RewardPercent && r.RewardType != RewardPoints {
+		return ErrBadRule
+	}
+	return nil
+}
+
+// reward начисление за один товар ценой price рублей
+func (r Rule) reward(price int) model.Money {
+	if r.RewardType == RewardPoints {
+		return r.Reward
+	}
+	priceMinor := int64(price) * model.MoneyScale
+	return model.Money(priceMinor * r.Reward.Minor() / (100 * model.MoneyScale))
+}
+
+type Config struct {
+	Rules []Rule
+
+	Latency    time.Duration // задержка перед каждым ответом
+	StepDelay  time.Duration // сколько заказ находится в REGISTERED и затем в PROCESSING
+	RetryAfter time.Duration // значение Retry-After в ответах 429
+
+	TooManyRequestsEvery int  // каждый N-й запрос получает 429, 0 — никогда
+	AutoRegister         bool // неизвестные валидные номера регистрируются со случайным составом при первом GET
+}
+
+type order struct {
+	number       string
+	goods        []model.OrderGoods
+	registeredAt time.Time
+}
+
+// Server in-memory accrual
+type Server struct {
+	mu       sync.Mutex
+	cfg      Config
+	rules    []Rule
+	orders   map[string]*order
+	requests int
+	now      func() time.Time
+}
+
+func NewServer(cfg Config) *Server {
+	if cfg.RetryAfter <= 0 {
+		cfg.RetryAfter = time.Second
+	}
+	return &Server{
+		cfg:    cfg,
+		rules:  append([]Rule(nil), cfg.Rules...),
+		orders: make(map[string]*order),
+		now:    time.Now,
+	}
+}
+
+// Handler роутер с API accrual
+func (s *Server) Handler() http.Handler {
+	r := chi.NewRouter()
+	r.Use(s.withLatency)
+	r.Use(s.withTooManyRequests)
+
+	r.Post("/api/goods", s.registerGoods)
+	r.Post("/api/orders", s.registerOrder)
+	r.Get("/api/orders/{number}", s.getOrder)
+	return r
+}
+
+func (s *Server) withLatency(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.cfg.Latency > 0 {
+			select {
+			case <-time.After(s.cfg.Latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) withTooManyRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.cfg.TooManyRequestsEvery > 0 {
+			s.mu.Lock()
+			s.requests++
+			limited := s.requests%s.cfg.TooManyRequestsEvery == 0
+			s.mu.Unlock()
+
+			if limited {
+				seconds := int((s.cfg.RetryAfter + time.Second - 1) / time.Second)
+				w.Header().Set("Retry-After", strconv.Itoa(seconds))
+				http.Error(w, "No more than N requests per minute allowed", http.StatusTooManyRequests)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) registerGoods(w http.ResponseWriter, r *http.Request) {
+	var rule Rule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil || rule.validate() != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.rules {
+		if strings.EqualFold(existing.Match, rule.Match) {
+			http.Error(w, "match already registered", http.StatusConflict)
+			return
+		}
+	}
+	s.rules = append(s.rules, rule)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) registerOrder(w http.ResponseWriter, r *http.Request) {
+	var req accrual.AccrualRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !utils.IsValidLuhn(req.Order) {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.orders[req.Order]; ok {
+		http.Error(w, "order already registered", http.StatusConflict)
+		return
+	}
+	s.orders[req.Order] = &order{
+		number:       req.Order,
+		goods:        req.Goods,
+		registeredAt: s.now(),
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *Server) getOrder(w http.ResponseWriter, r *http.Request) {
+	number := chi.URLParam(r, "number")
+
+	s.mu.Lock()
+	o, ok := s.orders[number]
+	if !ok && s.cfg.AutoRegister && utils.IsValidLuhn(number) {
+		o = &order{
+			number:       number,
+			goods:        ordergen.GenerateRandomGoods(),
+			registeredAt: s.now(),
+		}
+		s.orders[number] = o
+		ok = true
+	}
+	var resp accrual.AccrualResponse
+	if ok {
+		resp = s.status(o)
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// status расчёт проходит REGISTERED → PROCESSING → PROCESSED, по StepDelay на каждый промежуточный статус.
+// Заказ без единого подходящего под правила товара становится INVALID
+func (s *Server) status(o *order) accrual.AccrualResponse {
+	resp := accrual.AccrualResponse{Order: o.number}
+
+	elapsed := s.now().Sub(o.registeredAt)
+	switch {
+	case elapsed < s.cfg.StepDelay:
+		resp.Status = accrual.StatusRegistered
+		return resp
+	case elapsed < 2*s.cfg.StepDelay:
+		resp.Status = accrual.StatusProcessing
+		return resp
+	}
+
+	total, matched := s.calculate(o.goods)
+	if !matched {
+		resp.Status = accrual.StatusInvalid
+		return resp
+	}
+	resp.Status = accrual.StatusProcessed
+	if total > 0 {
+		resp.Accrual = &total
+	}
+	return resp
+}
+
+func (s *Server) calculate(goods []model.OrderGoods) (model.Money, bool) {
+	var (
+		total   model.Money
+		matched bool
+	)
+	for _, g := range goods {
+		for _, rule := range s.rules {
+			if strings.Contains(strings.ToLower(g.Description), strings.ToLower(rule.Match)) {
+				total += rule.reward(g.Price)
+				matched = true
+				break
+			}
+		}
+	}
+	return total, matched
+}
+
+// ParseRules разбирает правила вида "Bork:10%,LG:500" (без % — баллы за товар)
+func ParseRules(s string) ([]Rule, error) {
+	var rules []Rule
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		match, reward, ok := strings.Cut(part, ":")
+		if !ok {
+			return nil, ErrBadRule
+		}
+		rule := Rule{Match: strings.TrimSpace(match), RewardType: RewardPoints}
+		if strings.HasSuffix(reward, RewardPercent) {
+			rule.RewardType = RewardPercent
+			reward = strings.TrimSuffix(reward, RewardPercent)
+		}
+		amount, err := model.ParseMoney(reward)
+		if err != nil {
+			return nil, ErrBadRule
+		}
+		rule.Reward = amount
+		if err := rule.validate(); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
@@ -0,0 +1,109 @@
+package fake
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/divanov-web/gophermart/internal/accrual"
+	"github.com/divanov-web/gophermart/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestServer_StatusTransitions(t *testing.T) {
+	rules, err := ParseRules("Bork:10%,LG:500")
+	require.NoError(t, err)
+
+	srv := NewServer(Config{Rules: rules, StepDelay: time.Minute})
+	now := time.Now()
+	srv.now = func() time.Time { return now }
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+	client := accrual.NewClient(ts.URL, zap.NewNop().Sugar())
+
+	resp, err := client.GetOrderInfo(context.Background(), "79927398713")
+	require.NoError(t, err)
+	assert.Nil(t, resp, "unknown order must answer 204")
+
+	require.NoError(t, sendOrder(ts.URL, "79927398713", []model.OrderGoods{
+		{Description: "Чайник Bork", Price: 7000},
+		{Description: "Холодильник LG", Price: 50000},
+	}))
+	require.NoError(t, sendOrder(ts.URL, "2377225624", []model.OrderGoods{
+		{Description: "Стол", Price: 1000},
+	}))
+
+	steps := []struct {
+		after   time.Duration
+		number  string
+		status  accrual.AccrualStatus
+		accrual *model.Money
+	}{
+		{after: 0, number: "79927398713", status: "REGISTERED"},
+		{after: time.Minute, number: "79927398713", status: "PROCESSING"},
+		{after: 2 * time.Minute, number: "79927398713", status: "PROCESSED", accrual: moneyPtr(120000)},
+		{after: 2 * time.Minute, number: "2377225624", status: "INVALID"},
+	}
+	for _, step := range steps {
+		srv.now = func() time.Time { return now.Add(step.after) }
+		resp, err := client.GetOrderInfo(context.Background(), step.number)
+		require.NoError(t, err)
+		require.NotNil(t, resp)
+		assert.Equal(t, step.status, resp.Status, "after %s", step.after)
+		assert.Equal(t, step.accrual, resp.Accrual)
+	}
+}
+
+func TestServer_TooManyRequests(t *testing.T) {
+	srv := NewServer(Config{TooManyRequestsEvery: 2, RetryAfter: 3 * time.Second, AutoRegister: true})
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+	client := accrual.NewClient(ts.URL, zap.NewNop().Sugar())
+
+	_, err := client.GetOrderInfo(context.Background(), "79927398713")
+	require.NoError(t, err)
+
+	_, err = client.GetOrderInfo(context.Background(), "79927398713")
+	var rateErr *accrual.RateLimitError
+	require.ErrorAs(t, err, &rateErr)
+	assert.Equal(t, 3*time.Second, rateErr.RetryAfter)
+}
+
+func TestServer_RegisterGoods(t *testing.T) {
+	ts := httptest.NewServer(NewServer(Config{}).Handler())
+	defer ts.Close()
+
+	post := func(body string) int {
+		resp, err := http.Post(ts.URL+"/api/goods", "application/json", bytes.NewBufferString(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusOK, post(`{"match": "Bork", "reward": 10, "reward_type": "%"}`))
+	assert.Equal(t, http.StatusConflict, post(`{"match": "bork", "reward": 5, "reward_type": "pt"}`))
+	assert.Equal(t, http.StatusBadRequest, post(`{"match": "LG", "reward": 5, "reward_type": "x"}`))
+}
+
+func sendOrder(baseURL, number string, goods []model.OrderGoods) error {
+	data, err := json.Marshal(accrual.AccrualRequest{Order: number, Goods: goods})
+	if err != nil {
+		return err
+	}
+	resp, err := http.Post(baseURL+"/api/orders", "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func moneyPtr(v model.Money) *model.Money {
+	return &v
+}
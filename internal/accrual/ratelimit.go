@@ -0,0 +1,87 @@
+package accrual
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultRetryAfter пауза, если accrual ответил 429 без корректного Retry-After
+const DefaultRetryAfter = 60 * time.Second
+
+// ErrRateLimited базовая ошибка превышения лимита запросов к accrual
+var ErrRateLimited = errors.New("accrual rate limit exceeded")
+
+// RateLimitError ответ 429 от accrual с временем, которое сервер просит подождать
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrRateLimited, e.RetryAfter)
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return ErrRateLimited
+}
+
+// parseRetryAfter разбирает заголовок Retry-After (секунды или HTTP-дата)
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return DefaultRetryAfter
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds <= 0 {
+			return DefaultRetryAfter
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if d := at.Sub(now); d > 0 {
+			return d
+		}
+	}
+	return DefaultRetryAfter
+}
+
+func newRateLimitError(resp *http.Response) *RateLimitError {
+	return &RateLimitError{RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())}
+}
+
+// Pause общая пауза обращений к accrual, разделяемая всеми воркерами
+type Pause struct {
+	mu    sync.Mutex
+	until time.Time
+}
+
+func NewPause() *Pause {
+	return &Pause{}
+}
+
+// Set приостанавливает обращения на d. Уже назначенная более длинная пауза не сокращается
+func (p *Pause) Set(d time.Duration) time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	until := time.Now().Add(d)
+	if until.After(p.until) {
+		p.until = until
+	}
+	return p.until
+}
+
+// Remaining сколько ещё осталось ждать; 0 — пауза не действует
+func (p *Pause) Remaining() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if d := time.Until(p.until); d > 0 {
+		return d
+	}
+	return 0
+}
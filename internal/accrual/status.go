@@ -0,0 +1,48 @@
+package accrual
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// AccrualStatus статус расчёта начисления в accrual
+type AccrualStatus string
+
+const (
+	StatusRegistered AccrualStatus = "REGISTERED" // заказ зарегистрирован, начисление не рассчитано
+	StatusProcessing AccrualStatus = "PROCESSING" // расчёт в процессе
+	StatusInvalid    AccrualStatus = "INVALID"    // заказ не принят к расчёту, начисления не будет
+	StatusProcessed  AccrualStatus = "PROCESSED"  // расчёт окончен
+)
+
+// ErrUnknownStatus accrual вернул статус, которого нет в протоколе
+var ErrUnknownStatus = errors.New("unknown accrual status")
+
+// ParseAccrualStatus строгий разбор статуса: регистр и пробелы не нормализуются
+func ParseAccrualStatus(s string) (AccrualStatus, error) {
+	switch st := AccrualStatus(s); st {
+	case StatusRegistered, StatusProcessing, StatusInvalid, StatusProcessed:
+		return st, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnknownStatus, s)
+	}
+}
+
+// Final true для статусов, после которых accrual заказ больше не меняет
+func (s AccrualStatus) Final() bool {
+	return s == StatusInvalid || s == StatusProcessed
+}
+
+func (s *AccrualStatus) UnmarshalJSON(data []byte) error {
+	var raw string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("%w: %s", ErrUnknownStatus, data)
+	}
+	parsed, err := ParseAccrualStatus(raw)
+	if err != nil {
+		return err
+	}
+	*s = parsed
+	return nil
+}
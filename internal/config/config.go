@@ -4,6 +4,7 @@ import (
 	"flag"
 	"github.com/caarlos0/env/v6"
 	"github.com/joho/godotenv"
+	"time"
 )
 
 type Config struct {
@@ -12,6 +13,48 @@ type Config struct {
 	AuthSecret     string `env:"AUTH_SECRET"`
 	AccrualAddress string `env:"ACCRUAL_SYSTEM_ADDRESS"`
 	SendOrders     bool   `env:"SEND_ORDERS"` //Отправляет заказы в accrual, включать только локально для формирования заглушек.
+
+	AccrualWorkers     int           `env:"ACCRUAL_WORKERS"`      // число параллельных запросов статусов в accrual
+	AccrualPollTimeout time.Duration `env:"ACCRUAL_POLL_TIMEOUT"` // дедлайн одного прохода опроса accrual, 0 — интервал тикера
+
+	AccrualRequestTimeout time.Duration `env:"ACCRUAL_REQUEST_TIMEOUT"` // таймаут одного запроса к accrual
+	AccrualMaxIdleConns   int           `env:"ACCRUAL_MAX_IDLE_CONNS"`  // размер пула простаивающих соединений к accrual
+	AccrualKeepAlive      time.Duration `env:"ACCRUAL_KEEP_ALIVE"`      // период TCP keep-alive соединений к accrual
+	AccrualTLSCAFile      string        `env:"ACCRUAL_TLS_CA_FILE"`     // корневые сертификаты accrual (PEM)
+	AccrualTLSInsecure    bool          `env:"ACCRUAL_TLS_INSECURE"`    // не проверять сертификат accrual, только для разработки
+
+	AccrualBreakerFailures int           `env:"ACCRUAL_BREAKER_FAILURES"` // ошибок подряд до размыкания автомата
+	AccrualBreakerCooldown time.Duration `env:"ACCRUAL_BREAKER_COOLDOWN"` // время в разомкнутом состоянии до пробного запроса
+	AccrualBreakerProbes   int           `env:"ACCRUAL_BREAKER_PROBES"`   // пробных запросов в half-open
+
+	AccrualCallbackSecret string        `env:"ACCRUAL_CALLBACK_SECRET"`        // секрет HMAC callback-ов accrual, пусто — callback выключен
+	AccrualFallbackPoll   time.Duration `env:"ACCRUAL_FALLBACK_POLL_INTERVAL"` // интервал резервного опроса accrual при включённом callback
+
+	OrderRetryBase   time.Duration `env:"ORDER_RETRY_BASE"`   // первая задержка повторной проверки заказа, дальше удваивается
+	OrderRetryMax    time.Duration `env:"ORDER_RETRY_MAX"`    // потолок задержки между проверками заказа
+	OrderMaxAttempts int           `env:"ORDER_MAX_ATTEMPTS"` // неудачных проверок до перевода заказа в STUCK
+	OrderMaxAge      time.Duration `env:"ORDER_MAX_AGE"`      // возраст заказа, после которого неудачная проверка переводит его в STUCK
+
+	OrderClaimBatch int           `env:"ORDER_CLAIM_BATCH"` // сколько заказов реплика захватывает за один проход
+	OrderClaimLease time.Duration `env:"ORDER_CLAIM_LEASE"` // срок аренды захваченного заказа, после него заказ может взять другая реплика
+
+	LeaderElectionInterval time.Duration `env:"LEADER_ELECTION_INTERVAL"` // период попыток стать лидером фоновых задач
+
+	AuthKeysFile   string        `env:"AUTH_KEYS_FILE"`            // JSON-файл ключей подписи JWT; если задан, AUTH_SECRET не используется
+	AuthKeysReload time.Duration `env:"AUTH_KEYS_RELOAD_INTERVAL"` // период проверки файла ключей на изменения
+
+	AccessTokenTTL  time.Duration `env:"ACCESS_TOKEN_TTL"`  // время жизни access JWT
+	RefreshTokenTTL time.Duration `env:"REFRESH_TOKEN_TTL"` // время жизни refresh-токена, продлевается ротацией
+	SessionCacheTTL time.Duration `env:"SESSION_CACHE_TTL"` // сколько кэшировать проверку отзыва сессии; отзыв на других репликах виден с этой задержкой
+
+	IdempotencyKeyTTL      time.Duration `env:"IDEMPOTENCY_KEY_TTL"`      // время хранения ответов по Idempotency-Key
+	IdempotencyLockTimeout time.Duration `env:"IDEMPOTENCY_LOCK_TIMEOUT"` // сколько незавершённый запрос держит Idempotency-Key, потом повтор выполняется заново
+
+	SchemaCheckOnly bool `env:"SCHEMA_CHECK_ONLY"` // не мигрировать БД при старте, а отказаться стартовать при отставании схемы
+
+	MetricsAddress string `env:"METRICS_ADDRESS"` // адрес внутреннего сервера метрик /debug/vars, пусто — сервер выключен
+
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT"` // сколько ждать завершения запросов и воркеров при остановке
 }
 
 func NewConfig() *Config {
@@ -26,6 +69,35 @@ func NewConfig() *Config {
 	flag.StringVar(&cfg.AuthSecret, "auth-secret", cfg.AuthSecret, "секрет для подписи JWT")
 	flag.StringVar(&cfg.AccrualAddress, "r", cfg.AccrualAddress, "адрес системы начисления баллов accrual")
 	flag.BoolVar(&cfg.SendOrders, "send-orders", cfg.SendOrders, "включить отправку заказов в accrual-систему")
+	flag.IntVar(&cfg.AccrualWorkers, "accrual-workers", cfg.AccrualWorkers, "число воркеров опроса accrual")
+	flag.DurationVar(&cfg.AccrualPollTimeout, "accrual-poll-timeout", cfg.AccrualPollTimeout, "дедлайн одного прохода опроса accrual")
+	flag.DurationVar(&cfg.AccrualRequestTimeout, "accrual-request-timeout", cfg.AccrualRequestTimeout, "таймаут одного запроса к accrual")
+	flag.IntVar(&cfg.AccrualMaxIdleConns, "accrual-max-idle-conns", cfg.AccrualMaxIdleConns, "размер пула простаивающих соединений к accrual")
+	flag.DurationVar(&cfg.AccrualKeepAlive, "accrual-keep-alive", cfg.AccrualKeepAlive, "период TCP keep-alive соединений к accrual")
+	flag.StringVar(&cfg.AccrualTLSCAFile, "accrual-tls-ca-file", cfg.AccrualTLSCAFile, "корневые сертификаты accrual (PEM)")
+	flag.BoolVar(&cfg.AccrualTLSInsecure, "accrual-tls-insecure", cfg.AccrualTLSInsecure, "не проверять TLS-сертификат accrual")
+	flag.IntVar(&cfg.AccrualBreakerFailures, "accrual-breaker-failures", cfg.AccrualBreakerFailures, "ошибок accrual подряд до размыкания автомата")
+	flag.DurationVar(&cfg.AccrualBreakerCooldown, "accrual-breaker-cooldown", cfg.AccrualBreakerCooldown, "время в разомкнутом состоянии до пробного запроса")
+	flag.IntVar(&cfg.AccrualBreakerProbes, "accrual-breaker-probes", cfg.AccrualBreakerProbes, "пробных запросов к accrual в half-open")
+	flag.StringVar(&cfg.AccrualCallbackSecret, "accrual-callback-secret", cfg.AccrualCallbackSecret, "секрет HMAC для POST /internal/accrual/callback, пусто — callback выключен")
+	flag.DurationVar(&cfg.AccrualFallbackPoll, "accrual-fallback-poll", cfg.AccrualFallbackPoll, "интервал резервного опроса accrual при включённом callback")
+	flag.DurationVar(&cfg.OrderRetryBase, "order-retry-base", cfg.OrderRetryBase, "первая задержка повторной проверки заказа в accrual")
+	flag.DurationVar(&cfg.OrderRetryMax, "order-retry-max", cfg.OrderRetryMax, "максимальная задержка между проверками заказа")
+	flag.IntVar(&cfg.OrderMaxAttempts, "order-max-attempts", cfg.OrderMaxAttempts, "неудачных проверок до перевода заказа в STUCK")
+	flag.DurationVar(&cfg.OrderMaxAge, "order-max-age", cfg.OrderMaxAge, "возраст заказа, после которого он переводится в STUCK")
+	flag.IntVar(&cfg.OrderClaimBatch, "order-claim-batch", cfg.OrderClaimBatch, "сколько заказов реплика захватывает за проход")
+	flag.DurationVar(&cfg.OrderClaimLease, "order-claim-lease", cfg.OrderClaimLease, "срок аренды захваченного заказа")
+	flag.DurationVar(&cfg.LeaderElectionInterval, "leader-election-interval", cfg.LeaderElectionInterval, "период попыток стать лидером фоновых задач")
+	flag.StringVar(&cfg.AuthKeysFile, "auth-keys-file", cfg.AuthKeysFile, "JSON-файл ключей подписи JWT с активным и выведенными ключами")
+	flag.DurationVar(&cfg.AuthKeysReload, "auth-keys-reload", cfg.AuthKeysReload, "период проверки файла ключей JWT на изменения")
+	flag.DurationVar(&cfg.AccessTokenTTL, "access-token-ttl", cfg.AccessTokenTTL, "время жизни access-токена")
+	flag.DurationVar(&cfg.RefreshTokenTTL, "refresh-token-ttl", cfg.RefreshTokenTTL, "время жизни refresh-токена")
+	flag.DurationVar(&cfg.SessionCacheTTL, "session-cache-ttl", cfg.SessionCacheTTL, "время кэширования проверки отзыва сессии")
+	flag.DurationVar(&cfg.IdempotencyKeyTTL, "idempotency-key-ttl", cfg.IdempotencyKeyTTL, "время хранения ответов по Idempotency-Key")
+	flag.DurationVar(&cfg.IdempotencyLockTimeout, "idempotency-lock-timeout", cfg.IdempotencyLockTimeout, "сколько незавершённый запрос держит Idempotency-Key")
+	flag.BoolVar(&cfg.SchemaCheckOnly, "schema-check-only", cfg.SchemaCheckOnly, "не применять миграции при старте, остановиться если схема БД отстаёт")
+	flag.StringVar(&cfg.MetricsAddress, "metrics-address", cfg.MetricsAddress, "адрес внутреннего сервера метрик, пусто — выключен")
+	flag.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", cfg.ShutdownTimeout, "таймаут graceful shutdown")
 	flag.Parse()
 
 	if cfg.ServerAddress == "" {
@@ -37,6 +109,54 @@ func NewConfig() *Config {
 	if cfg.AccrualAddress == "" {
 		cfg.AccrualAddress = "http://localhost:8080"
 	}
+	if cfg.AccrualWorkers <= 0 {
+		cfg.AccrualWorkers = 4
+	}
+	if cfg.AccrualFallbackPoll <= 0 {
+		cfg.AccrualFallbackPoll = time.Minute
+	}
+	if cfg.OrderRetryBase <= 0 {
+		cfg.OrderRetryBase = 5 * time.Second
+	}
+	if cfg.OrderRetryMax <= 0 {
+		cfg.OrderRetryMax = time.Hour
+	}
+	if cfg.OrderMaxAttempts <= 0 {
+		cfg.OrderMaxAttempts = 20
+	}
+	if cfg.OrderMaxAge <= 0 {
+		cfg.OrderMaxAge = 72 * time.Hour
+	}
+	if cfg.OrderClaimBatch <= 0 {
+		cfg.OrderClaimBatch = 100
+	}
+	if cfg.OrderClaimLease <= 0 {
+		cfg.OrderClaimLease = time.Minute
+	}
+	if cfg.LeaderElectionInterval <= 0 {
+		cfg.LeaderElectionInterval = 5 * time.Second
+	}
+	if cfg.AuthKeysReload <= 0 {
+		cfg.AuthKeysReload = 30 * time.Second
+	}
+	if cfg.AccessTokenTTL <= 0 {
+		cfg.AccessTokenTTL = 15 * time.Minute
+	}
+	if cfg.RefreshTokenTTL <= 0 {
+		cfg.RefreshTokenTTL = 30 * 24 * time.Hour
+	}
+	if cfg.SessionCacheTTL <= 0 {
+		cfg.SessionCacheTTL = 30 * time.Second
+	}
+	if cfg.IdempotencyKeyTTL <= 0 {
+		cfg.IdempotencyKeyTTL = 24 * time.Hour
+	}
+	if cfg.IdempotencyLockTimeout <= 0 {
+		cfg.IdempotencyLockTimeout = time.Minute
+	}
+	if cfg.ShutdownTimeout <= 0 {
+		cfg.ShutdownTimeout = 10 * time.Second
+	}
 
 	return cfg
 }
@@ -3,10 +3,10 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
-	"github.com/divanov-web/gophermart/internal/middleware"
 	"github.com/divanov-web/gophermart/internal/service"
 	"go.uber.org/zap"
 	"net/http"
+	"strconv"
 )
 
 type BalanceHandler struct {
@@ -24,11 +24,11 @@ func NewBalanceHandler(orderService *service.OrderService, userService *service.
 }
 
 func (h *BalanceHandler) Withdraw(w http.ResponseWriter, r *http.Request) {
-	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	principal, ok := requestPrincipal(w, r)
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
+	userID := principal.UserID
 
 	var req service.WithdrawalRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -44,17 +44,19 @@ func (h *BalanceHandler) Withdraw(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid order number", http.StatusUnprocessableEntity)
 	case errors.Is(err, service.ErrInsufficientFunds):
 		http.Error(w, "not enough funds", http.StatusPaymentRequired) // 402
+	case errors.Is(err, service.ErrWithdrawOrderUsed):
+		http.Error(w, "order already paid with points", http.StatusConflict)
 	default:
 		http.Error(w, "internal error", http.StatusInternalServerError)
 	}
 }
 
 func (h *BalanceHandler) GetBalance(w http.ResponseWriter, r *http.Request) {
-	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	principal, ok := requestPrincipal(w, r)
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
+	userID := principal.UserID
 
 	balance, err := h.UserService.GetUserBalance(r.Context(), userID)
 	if err != nil {
@@ -72,11 +74,11 @@ func (h *BalanceHandler) GetBalance(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *BalanceHandler) GetWithdrawals(w http.ResponseWriter, r *http.Request) {
-	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	principal, ok := requestPrincipal(w, r)
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
+	userID := principal.UserID
 
 	withdrawals, err := h.UserService.GetWithdrawals(r.Context(), userID)
 	if err != nil {
@@ -97,3 +99,45 @@ func (h *BalanceHandler) GetWithdrawals(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "serialization error", http.StatusInternalServerError)
 	}
 }
+
+// GetHistory история движения баллов: GET /api/user/balance/history?cursor=...&limit=...
+func (h *BalanceHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requestPrincipal(w, r)
+	if !ok {
+		return
+	}
+	userID := principal.UserID
+
+	limit := 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	history, err := h.UserService.GetBalanceHistory(r.Context(), userID, r.URL.Query().Get("cursor"), limit)
+	switch {
+	case errors.Is(err, service.ErrInvalidCursor):
+		http.Error(w, "invalid cursor", http.StatusBadRequest)
+		return
+	case err != nil:
+		h.logger.Errorw("failed to get balance history", "error", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if len(history.Items) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(history); err != nil {
+		h.logger.Errorw("failed to encode balance history", "error", err)
+		http.Error(w, "serialization error", http.StatusInternalServerError)
+	}
+}
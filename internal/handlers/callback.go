@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/divanov-web/gophermart/internal/accrual"
+	"github.com/divanov-web/gophermart/internal/service"
+	"go.uber.org/zap"
+)
+
+// maxCallbackBody ограничение размера тела callback-запроса
+const maxCallbackBody = 64 << 10
+
+type AccrualCallbackHandler struct {
+	service *service.OrderService
+	secret  []byte
+	logger  *zap.SugaredLogger
+}
+
+func NewAccrualCallbackHandler(service *service.OrderService, secret string, logger *zap.SugaredLogger) *AccrualCallbackHandler {
+	return &AccrualCallbackHandler{
+		service: service,
+		secret:  []byte(secret),
+		logger:  logger,
+	}
+}
+
+// Callback принимает от accrual статус заказа, подписанный HMAC общим секретом
+func (h *AccrualCallbackHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxCallbackBody+1))
+	if err != nil || len(body) == 0 || len(body) > maxCallbackBody {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	err = accrual.VerifyCallback(
+		h.secret,
+		r.Header.Get(accrual.TimestampHeader),
+		r.Header.Get(accrual.SignatureHeader),
+		body,
+		time.Now(),
+		accrual.DefaultCallbackTolerance,
+	)
+	if err != nil {
+		h.logger.Warnw("accrual callback rejected", "error", err, "remote", r.RemoteAddr)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var resp accrual.AccrualResponse
+	if err := json.Unmarshal(body, &resp); err != nil || resp.Order == "" {
+		if errors.Is(err, accrual.ErrUnknownStatus) {
+			h.logger.Warnw("accrual callback with unknown status", "error", err)
+		}
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	err = h.service.ApplyAccrualCallback(r.Context(), resp)
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusOK)
+	case errors.Is(err, service.ErrUnknownAccrualStatus):
+		http.Error(w, "unknown status", http.StatusBadRequest)
+	case errors.Is(err, service.ErrOrderNotFound):
+		http.Error(w, "order not found", http.StatusNotFound)
+	default:
+		// accrual повторит запрос, а если нет — заказ доберёт резервный опрос
+		h.logger.Errorw("accrual callback failed", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}
+}
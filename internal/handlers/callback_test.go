@@ -0,0 +1,141 @@
+package handlers_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/divanov-web/gophermart/internal/accrual"
+	"github.com/divanov-web/gophermart/internal/config"
+	"github.com/divanov-web/gophermart/internal/handlers"
+	"github.com/divanov-web/gophermart/internal/mocks"
+	"github.com/divanov-web/gophermart/internal/model"
+	"github.com/divanov-web/gophermart/internal/repository"
+	"github.com/divanov-web/gophermart/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap/zaptest"
+	"gorm.io/gorm"
+)
+
+const callbackSecret = "callback-secret"
+
+func TestAccrualCallbackHandler(t *testing.T) {
+	processing := func() *model.Order {
+		return &model.Order{ID: 1, Number: "79927398713", UserID: 42, Status: model.OrderStatusProcessing}
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		secret     string
+		signedAt   time.Time
+		unsigned   bool
+		mockSetup  func(*mocks.MockOrderRepo)
+		wantStatus int
+	}{
+		{
+			name: "PROCESSED credits order",
+			body: `{"order":"79927398713","status":"PROCESSED","accrual":500}`,
+			mockSetup: func(repo *mocks.MockOrderRepo) {
+				repo.On("GetByNumber", mock.Anything, "79927398713").Return(processing(), nil)
+				repo.On("MarkProcessed", mock.Anything, mock.AnythingOfType("*model.Order"), mock.MatchedBy(func(m *model.Money) bool {
+					return m != nil && *m == 50000
+				})).Return(nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "INVALID marks order invalid",
+			body: `{"order":"79927398713","status":"INVALID"}`,
+			mockSetup: func(repo *mocks.MockOrderRepo) {
+				repo.On("GetByNumber", mock.Anything, "79927398713").Return(processing(), nil)
+				repo.On("MarkInvalid", mock.Anything, mock.MatchedBy(func(o *model.Order) bool {
+					return o.ID == 1
+				})).Return(nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "INVALID after concurrent PROCESSED keeps processed order",
+			body: `{"order":"79927398713","status":"INVALID"}`,
+			mockSetup: func(repo *mocks.MockOrderRepo) {
+				repo.On("GetByNumber", mock.Anything, "79927398713").Return(processing(), nil)
+				repo.On("MarkInvalid", mock.Anything, mock.AnythingOfType("*model.Order")).Return(repository.ErrOrderNotProcessing)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "already processed order is skipped",
+			body: `{"order":"79927398713","status":"PROCESSED","accrual":500}`,
+			mockSetup: func(repo *mocks.MockOrderRepo) {
+				repo.On("GetByNumber", mock.Anything, "79927398713").Return(&model.Order{ID: 1, Status: model.OrderStatusProcessed}, nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "unknown order",
+			body: `{"order":"79927398713","status":"PROCESSED","accrual":500}`,
+			mockSetup: func(repo *mocks.MockOrderRepo) {
+				repo.On("GetByNumber", mock.Anything, "79927398713").Return(nil, gorm.ErrRecordNotFound)
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "unknown status",
+			body:       `{"order":"79927398713","status":"DONE"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "wrong secret",
+			body:       `{"order":"79927398713","status":"PROCESSED","accrual":500}`,
+			secret:     "other-secret",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "stale signature",
+			body:       `{"order":"79927398713","status":"PROCESSED","accrual":500}`,
+			signedAt:   time.Now().Add(-time.Hour),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "unsigned",
+			body:       `{"order":"79927398713","status":"PROCESSED","accrual":500}`,
+			unsigned:   true,
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orderRepo := new(mocks.MockOrderRepo)
+			if tt.mockSetup != nil {
+				tt.mockSetup(orderRepo)
+			}
+			logger := zaptest.NewLogger(t).Sugar()
+			svc := service.NewOrderService(orderRepo, new(mocks.MockUserRepo), logger, &config.Config{})
+			handler := handlers.NewAccrualCallbackHandler(svc, callbackSecret, logger)
+
+			req := httptest.NewRequest(http.MethodPost, "/internal/accrual/callback", bytes.NewBufferString(tt.body))
+			if !tt.unsigned {
+				secret, signedAt := tt.secret, tt.signedAt
+				if secret == "" {
+					secret = callbackSecret
+				}
+				if signedAt.IsZero() {
+					signedAt = time.Now()
+				}
+				req.Header.Set(accrual.TimestampHeader, strconv.FormatInt(signedAt.Unix(), 10))
+				req.Header.Set(accrual.SignatureHeader, accrual.SignCallback([]byte(secret), signedAt, []byte(tt.body)))
+			}
+			resp := httptest.NewRecorder()
+			handler.Callback(resp, req)
+
+			assert.Equal(t, tt.wantStatus, resp.Code)
+			orderRepo.AssertExpectations(t)
+		})
+	}
+}
@@ -1,7 +1,12 @@
 package handlers
 
 import (
+	"net/http"
+
+	"github.com/divanov-web/gophermart/internal/accrual"
 	"github.com/divanov-web/gophermart/internal/config"
+	"github.com/divanov-web/gophermart/internal/keyring"
+	"github.com/divanov-web/gophermart/internal/leader"
 	"github.com/divanov-web/gophermart/internal/middleware"
 	"github.com/divanov-web/gophermart/internal/service"
 	"github.com/go-chi/chi/v5"
@@ -15,7 +20,12 @@ type Handler struct {
 // NewHandler разводящий для хендлеров
 func NewHandler(
 	userService *service.UserService,
+	authService *service.AuthService,
+	keys *keyring.Keyring,
 	orderService *service.OrderService,
+	idempotencyService *service.IdempotencyService,
+	accrualBreaker *accrual.Breaker,
+	elector *leader.Elector,
 	logger *zap.SugaredLogger,
 	config *config.Config,
 ) *Handler {
@@ -23,26 +33,60 @@ func NewHandler(
 
 	r.Use(middleware.WithGzip)
 	r.Use(middleware.WithLogging)
-	r.Use(middleware.WithAuth(config.AuthSecret))
+	r.Use(middleware.WithAuth(keys, authService))
 
 	// Handlers
-	userHandler := NewUserHandler(userService, logger, config)
+	userHandler := NewUserHandler(userService, authService, logger, config)
 	orderHandler := NewOrderHandler(orderService, logger)
 	balanceHandler := NewBalanceHandler(orderService, userService, logger)
+	healthHandler := NewHealthHandler(accrualBreaker, elector)
+
+	r.Get("/health", healthHandler.Health)
+
+	// callback от accrual включается секретом; без него статусы заказов только опрашиваются
+	if config.AccrualCallbackSecret != "" {
+		callbackHandler := NewAccrualCallbackHandler(orderService, config.AccrualCallbackSecret, logger)
+		r.Post("/internal/accrual/callback", callbackHandler.Callback)
+	}
+
+	// Публичные маршруты: вход и обновление токенов
+	r.Group(func(r chi.Router) {
+		r.Post("/api/user/register", userHandler.Register)
+		r.Post("/api/user/login", userHandler.Login)
+		r.Post("/api/user/token/refresh", userHandler.Refresh)
+		r.Post("/api/user/test", userHandler.Test)
+	})
 
-	// User routes
-	r.Post("/api/user/register", userHandler.Register)
-	r.Post("/api/user/login", userHandler.Login)
-	r.Post("/api/user/test", userHandler.Test)
+	// Маршруты пользователя: без валидного токена ответ 401 до вызова обработчика
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.RequireAuth)
 
-	// Order routes
-	r.Post("/api/user/orders", orderHandler.Upload)
-	r.Get("/api/user/orders", orderHandler.GetUserOrders)
+		// User routes
+		r.Post("/api/user/logout", userHandler.Logout)
+		r.Get("/api/user/sessions", userHandler.GetSessions)
+		r.Delete("/api/user/sessions/{id}", userHandler.DeleteSession)
 
-	// Withdraw routes
-	r.Post("/api/user/balance/withdraw", balanceHandler.Withdraw)
-	r.Get("/api/user/balance", balanceHandler.GetBalance)
-	r.Get("/api/user/withdrawals", balanceHandler.GetWithdrawals)
+		// Order routes
+		r.Post("/api/user/orders", orderHandler.Upload)
+		r.Get("/api/user/orders", orderHandler.GetUserOrders)
+
+		// Withdraw routes
+		r.With(WithIdempotency(idempotencyService, logger)).
+			Post("/api/user/balance/withdraw", balanceHandler.Withdraw)
+		r.Get("/api/user/balance", balanceHandler.GetBalance)
+		r.Get("/api/user/balance/history", balanceHandler.GetHistory)
+		r.Get("/api/user/withdrawals", balanceHandler.GetWithdrawals)
+	})
 
 	return &Handler{Router: r}
 }
+
+// requestPrincipal принципал запроса для обработчиков за RequireAuth. Если маршрут по ошибке
+// не закрыт RequireAuth, отвечает 401, а не обрабатывает запрос анонимно
+func requestPrincipal(w http.ResponseWriter, r *http.Request) (middleware.Principal, bool) {
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	}
+	return principal, ok
+}
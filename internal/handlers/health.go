@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/divanov-web/gophermart/internal/accrual"
+	"github.com/divanov-web/gophermart/internal/leader"
+)
+
+type HealthHandler struct {
+	breaker *accrual.Breaker
+	elector *leader.Elector
+}
+
+func NewHealthHandler(breaker *accrual.Breaker, elector *leader.Elector) *HealthHandler {
+	return &HealthHandler{breaker: breaker, elector: elector}
+}
+
+type AccrualHealth struct {
+	Circuit accrual.BreakerState `json:"circuit"`
+}
+
+type HealthResponse struct {
+	Status  string        `json:"status"`
+	Accrual AccrualHealth `json:"accrual"`
+	Leader  bool          `json:"leader"` // реплика выполняет фоновые задачи-одиночки
+}
+
+// Health состояние сервиса. Недоступность accrual не делает сервис нездоровым: заказы и баланс работают,
+// поэтому код ответа всегда 200, а статус меняется на degraded
+func (h *HealthHandler) Health(w http.ResponseWriter, r *http.Request) {
+	resp := HealthResponse{Status: "ok"}
+	if h.elector != nil {
+		resp.Leader = h.elector.IsLeader()
+	}
+	if h.breaker != nil {
+		resp.Accrual.Circuit = h.breaker.State()
+		if resp.Accrual.Circuit != accrual.BreakerClosed {
+			resp.Status = "degraded"
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, "serialization error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,51 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/divanov-web/gophermart/internal/config"
+	"github.com/divanov-web/gophermart/internal/handlers"
+	"github.com/divanov-web/gophermart/internal/keyring"
+	"github.com/divanov-web/gophermart/internal/middleware"
+	"github.com/divanov-web/gophermart/internal/mocks"
+	"github.com/divanov-web/gophermart/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestNewHandler_NoDebugVars(t *testing.T) {
+	logger := zap.NewNop().Sugar()
+	middleware.SetLogger(logger)
+	cfg := &config.Config{AuthSecret: "secret", AccessTokenTTL: time.Minute, RefreshTokenTTL: time.Hour}
+
+	keys := keyring.NewStatic(cfg.AuthSecret)
+	authService := service.NewAuthService(new(mocks.MockTokenRepo), new(mocks.MockSessionRepo), keys, logger, cfg)
+	userRepo := new(mocks.MockUserRepo)
+	orderService := service.NewOrderService(new(mocks.MockOrderRepo), userRepo, logger, cfg)
+	h := handlers.NewHandler(service.NewUserService(userRepo), authService, keys, orderService, nil, nil, nil, logger, cfg)
+
+	req := httptest.NewRequest(http.MethodGet, "/debug/vars", nil)
+	resp := httptest.NewRecorder()
+	h.Router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusNotFound, resp.Code, "metrics must not be served on the public router")
+}
+
+func TestMetricsHandler_DebugVars(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/debug/vars", nil)
+	resp := httptest.NewRecorder()
+	handlers.NewMetricsHandler().ServeHTTP(resp, req)
+
+	require.Equal(t, http.StatusOK, resp.Code)
+	var vars map[string]json.RawMessage
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&vars))
+	assert.Contains(t, vars, "leader")
+	assert.Contains(t, vars, "accrual_poll")
+	assert.NotContains(t, vars, "cmdline")
+	assert.NotContains(t, vars, "memstats")
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/divanov-web/gophermart/internal/middleware"
+	"github.com/divanov-web/gophermart/internal/service"
+	"go.uber.org/zap"
+)
+
+const (
+	idempotencyKeyHeader      = "Idempotency-Key"
+	idempotencyReplayedHeader = "Idempotent-Replayed"
+	// idempotencyErrorHeader причина отказа по Idempotency-Key: in-progress или key-reused
+	idempotencyErrorHeader = "Idempotency-Error"
+	maxIdempotentBodySize  = 1 << 20
+)
+
+// idempotencyResponseWriter запоминает ответ обработчика, чтобы сохранить его под ключом
+type idempotencyResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *idempotencyResponseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *idempotencyResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// WithIdempotency повторный запрос с тем же заголовком Idempotency-Key получает первый ответ
+// вместо повторного выполнения. Ответы 5xx не сохраняются, чтобы клиент мог повторить запрос
+func WithIdempotency(svc *service.IdempotencyService, logger *zap.SugaredLogger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(idempotencyKeyHeader)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > service.MaxIdempotencyKeyLength {
+				http.Error(w, "idempotency key too long", http.StatusBadRequest)
+				return
+			}
+
+			principal, ok := middleware.PrincipalFromContext(r.Context())
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			userID := principal.UserID
+
+			// читаем на байт больше лимита: обрезанное тело дало бы чужой отпечаток и неполный запрос обработчику
+			body, err := io.ReadAll(io.LimitReader(r.Body, maxIdempotentBodySize+1))
+			if err != nil {
+				http.Error(w, "bad request", http.StatusBadRequest)
+				return
+			}
+			if len(body) > maxIdempotentBodySize {
+				http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			record, reservation, err := svc.Begin(r.Context(), userID, key, service.Fingerprint(body))
+			switch {
+			// коды не пересекаются с ответами обработчиков (409 — заказ уже оплачен, 422 — неверный номер)
+			case errors.Is(err, service.ErrIdempotencyInProgress):
+				w.Header().Set(idempotencyErrorHeader, "in-progress")
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, "request with this idempotency key is in progress", http.StatusLocked)
+				return
+			case errors.Is(err, service.ErrIdempotencyKeyReused):
+				w.Header().Set(idempotencyErrorHeader, "key-reused")
+				http.Error(w, "idempotency key reused with different request", http.StatusPreconditionFailed)
+				return
+			case err != nil:
+				logger.Errorw("failed to check idempotency key", "error", err)
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			case record != nil:
+				if record.ContentType != "" {
+					w.Header().Set("Content-Type", record.ContentType)
+				}
+				w.Header().Set(idempotencyReplayedHeader, "true")
+				w.WriteHeader(record.StatusCode)
+				_, _ = w.Write(record.Body)
+				return
+			}
+
+			iw := &idempotencyResponseWriter{ResponseWriter: w}
+			stop := svc.KeepLocked(r.Context(), reservation)
+			next.ServeHTTP(iw, r)
+			stop()
+
+			// ответ сохраняем, даже если клиент уже отключился
+			ctx := context.WithoutCancel(r.Context())
+			status := iw.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			if status >= http.StatusInternalServerError {
+				if err := svc.Release(ctx, reservation); err != nil && !errors.Is(err, service.ErrIdempotencyLockLost) {
+					logger.Errorw("failed to release idempotency key", "error", err)
+				}
+				return
+			}
+			err = svc.Complete(ctx, reservation, status, w.Header().Get("Content-Type"), iw.body.Bytes())
+			switch {
+			case errors.Is(err, service.ErrIdempotencyLockLost):
+				logger.Warnw("idempotency key taken over by another request, response not stored", "userID", userID, "key", key)
+			case err != nil:
+				logger.Errorw("failed to store idempotent response", "error", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package handlers_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/divanov-web/gophermart/internal/handlers"
+	"github.com/divanov-web/gophermart/internal/middleware"
+	"github.com/divanov-web/gophermart/internal/mocks"
+	"github.com/divanov-web/gophermart/internal/model"
+	"github.com/divanov-web/gophermart/internal/repository"
+	"github.com/divanov-web/gophermart/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap"
+)
+
+func TestWithIdempotency(t *testing.T) {
+	const body = `{"order": "2377225624", "sum": 751}`
+	fingerprint := service.Fingerprint([]byte(body))
+
+	tests := []struct {
+		name         string
+		mockSetup    func(*mocks.MockIdempotencyRepo)
+		wantStatus   int
+		wantCalls    int
+		wantReplayed bool
+		wantError    string
+	}{
+		{
+			name: "first request is executed and stored",
+			mockSetup: func(repo *mocks.MockIdempotencyRepo) {
+				repo.On("Reserve", mock.Anything, mock.AnythingOfType("*model.IdempotencyRecord")).Return(true, nil)
+				repo.On("Complete", mock.Anything, int64(42), "key-1", mock.AnythingOfType("string"), http.StatusOK, "", mock.Anything).Return(nil)
+			},
+			wantStatus: http.StatusOK,
+			wantCalls:  1,
+		},
+		{
+			name: "replay returns stored response",
+			mockSetup: func(repo *mocks.MockIdempotencyRepo) {
+				repo.On("Reserve", mock.Anything, mock.Anything).Return(false, nil)
+				repo.On("Get", mock.Anything, int64(42), "key-1").Return(&model.IdempotencyRecord{
+					Fingerprint: fingerprint,
+					StatusCode:  http.StatusOK,
+					ExpiresAt:   time.Now().Add(time.Hour),
+				}, nil)
+			},
+			wantStatus:   http.StatusOK,
+			wantReplayed: true,
+		},
+		{
+			name: "same key in progress",
+			mockSetup: func(repo *mocks.MockIdempotencyRepo) {
+				repo.On("Reserve", mock.Anything, mock.Anything).Return(false, nil)
+				repo.On("Get", mock.Anything, int64(42), "key-1").Return(&model.IdempotencyRecord{
+					Fingerprint: fingerprint,
+					ExpiresAt:   time.Now().Add(time.Hour),
+					LockedUntil: time.Now().Add(time.Minute),
+				}, nil)
+			},
+			wantStatus: http.StatusLocked,
+			wantError:  "in-progress",
+		},
+		{
+			name: "abandoned key is reclaimed and executed",
+			mockSetup: func(repo *mocks.MockIdempotencyRepo) {
+				repo.On("Reserve", mock.Anything, mock.Anything).Return(false, nil)
+				repo.On("Get", mock.Anything, int64(42), "key-1").Return(&model.IdempotencyRecord{
+					Fingerprint: fingerprint,
+					ExpiresAt:   time.Now().Add(time.Hour),
+					LockedUntil: time.Now().Add(-time.Second),
+				}, nil)
+				repo.On("Reclaim", mock.Anything, mock.MatchedBy(func(r *model.IdempotencyRecord) bool {
+					return r.LockedUntil.After(time.Now())
+				}), mock.AnythingOfType("time.Time")).Return(true, nil)
+				repo.On("Complete", mock.Anything, int64(42), "key-1", mock.AnythingOfType("string"), http.StatusOK, "", mock.Anything).Return(nil)
+			},
+			wantStatus: http.StatusOK,
+			wantCalls:  1,
+		},
+		{
+			name: "abandoned key reclaimed by another retry",
+			mockSetup: func(repo *mocks.MockIdempotencyRepo) {
+				repo.On("Reserve", mock.Anything, mock.Anything).Return(false, nil)
+				repo.On("Get", mock.Anything, int64(42), "key-1").Return(&model.IdempotencyRecord{
+					Fingerprint: fingerprint,
+					ExpiresAt:   time.Now().Add(time.Hour),
+					LockedUntil: time.Now().Add(-time.Second),
+				}, nil)
+				repo.On("Reclaim", mock.Anything, mock.Anything, mock.Anything).Return(false, nil)
+			},
+			wantStatus: http.StatusLocked,
+			wantError:  "in-progress",
+		},
+		{
+			name: "same key with another body",
+			mockSetup: func(repo *mocks.MockIdempotencyRepo) {
+				repo.On("Reserve", mock.Anything, mock.Anything).Return(false, nil)
+				repo.On("Get", mock.Anything, int64(42), "key-1").Return(&model.IdempotencyRecord{
+					Fingerprint: "other",
+					StatusCode:  http.StatusOK,
+					ExpiresAt:   time.Now().Add(time.Hour),
+				}, nil)
+			},
+			wantStatus: http.StatusPreconditionFailed,
+			wantError:  "key-reused",
+		},
+		{
+			name: "server error releases key",
+			mockSetup: func(repo *mocks.MockIdempotencyRepo) {
+				repo.On("Reserve", mock.Anything, mock.Anything).Return(true, nil)
+				repo.On("Release", mock.Anything, int64(42), "key-1", mock.AnythingOfType("string")).Return(nil)
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantCalls:  1,
+		},
+		{
+			name: "response is not stored after key was taken over",
+			mockSetup: func(repo *mocks.MockIdempotencyRepo) {
+				repo.On("Reserve", mock.Anything, mock.Anything).Return(true, nil)
+				repo.On("Complete", mock.Anything, int64(42), "key-1", mock.AnythingOfType("string"), http.StatusOK, "", mock.Anything).
+					Return(repository.ErrIdempotencyLockLost)
+			},
+			wantStatus: http.StatusOK,
+			wantCalls:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := new(mocks.MockIdempotencyRepo)
+			tt.mockSetup(repo)
+			logger := zap.NewNop().Sugar()
+			svc := service.NewIdempotencyService(repo, time.Hour, time.Minute, logger)
+
+			calls := 0
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				if tt.wantStatus == http.StatusInternalServerError {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			})
+
+			r := chi.NewRouter()
+			r.Use(func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					ctx := middleware.WithPrincipal(r.Context(), middleware.Principal{UserID: 42})
+					next.ServeHTTP(w, r.WithContext(ctx))
+				})
+			})
+			r.With(handlers.WithIdempotency(svc, logger)).Post("/api/user/balance/withdraw", next)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/user/balance/withdraw", bytes.NewBufferString(body))
+			req.Header.Set("Idempotency-Key", "key-1")
+			resp := httptest.NewRecorder()
+			r.ServeHTTP(resp, req)
+
+			assert.Equal(t, tt.wantStatus, resp.Code)
+			assert.Equal(t, tt.wantCalls, calls)
+			assert.Equal(t, tt.wantReplayed, resp.Header().Get("Idempotent-Replayed") == "true")
+			assert.Equal(t, tt.wantError, resp.Header().Get("Idempotency-Error"))
+			repo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestWithIdempotency_KeepsLockWhileRunning(t *testing.T) {
+	repo := new(mocks.MockIdempotencyRepo)
+	var token string
+	repo.On("Reserve", mock.Anything, mock.AnythingOfType("*model.IdempotencyRecord")).
+		Run(func(args mock.Arguments) { token = args.Get(1).(*model.IdempotencyRecord).Token }).
+		Return(true, nil)
+	repo.On("Extend", mock.Anything, int64(42), "key-1", mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).Return(nil)
+	repo.On("Complete", mock.Anything, int64(42), "key-1", mock.AnythingOfType("string"), http.StatusOK, "", mock.Anything).Return(nil)
+	logger := zap.NewNop().Sugar()
+	svc := service.NewIdempotencyService(repo, time.Hour, 30*time.Millisecond, logger)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(60 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	})
+	h := handlers.WithIdempotency(svc, logger)(next)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/user/balance/withdraw", bytes.NewBufferString(`{}`))
+	req.Header.Set("Idempotency-Key", "key-1")
+	req = req.WithContext(middleware.WithPrincipal(req.Context(), middleware.Principal{UserID: 42}))
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.NotEmpty(t, token)
+	repo.AssertCalled(t, "Extend", mock.Anything, int64(42), "key-1", token, mock.AnythingOfType("time.Time"))
+	repo.AssertCalled(t, "Complete", mock.Anything, int64(42), "key-1", token, http.StatusOK, "", mock.Anything)
+}
+
+func TestWithIdempotency_BodyTooLarge(t *testing.T) {
+	repo := new(mocks.MockIdempotencyRepo)
+	logger := zap.NewNop().Sugar()
+	svc := service.NewIdempotencyService(repo, time.Hour, time.Minute, logger)
+
+	calls := 0
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	})
+	h := handlers.WithIdempotency(svc, logger)(next)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/user/balance/withdraw", bytes.NewReader(make([]byte, 1<<20+1)))
+	req.Header.Set("Idempotency-Key", "key-1")
+	req = req.WithContext(middleware.WithPrincipal(req.Context(), middleware.Principal{UserID: 42}))
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.Code)
+	assert.Equal(t, 0, calls)
+	repo.AssertNotCalled(t, "Reserve", mock.Anything, mock.Anything)
+}
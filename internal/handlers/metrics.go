@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// metricsVars expvar-переменные сервиса, которые отдаёт сервер метрик. Стандартные cmdline и memstats
+// не публикуются: в аргументах запуска бывают DSN и секреты
+var metricsVars = []string{"leader", "accrual_poll"}
+
+// NewMetricsHandler роутер внутреннего сервера метрик; слушает отдельный адрес, недоступный клиентам
+func NewMetricsHandler() http.Handler {
+	r := chi.NewRouter()
+	r.Get("/debug/vars", Vars)
+	return r
+}
+
+// Vars метрики сервиса в формате expvar
+func Vars(w http.ResponseWriter, r *http.Request) {
+	vars := make(map[string]json.RawMessage, len(metricsVars))
+	for _, name := range metricsVars {
+		if v := expvar.Get(name); v != nil {
+			vars[name] = json.RawMessage(v.String())
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(vars); err != nil {
+		http.Error(w, "serialization error", http.StatusInternalServerError)
+	}
+}
@@ -7,7 +7,6 @@ import (
 	"net/http"
 	"strings"
 
-	"github.com/divanov-web/gophermart/internal/middleware"
 	"github.com/divanov-web/gophermart/internal/service"
 	"go.uber.org/zap"
 )
@@ -26,11 +25,11 @@ func NewOrderHandler(service *service.OrderService, logger *zap.SugaredLogger) *
 
 // Upload обрабатывает загрузку номера заказа
 func (h *OrderHandler) Upload(w http.ResponseWriter, r *http.Request) {
-	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	principal, ok := requestPrincipal(w, r)
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
+	userID := principal.UserID
 
 	body, err := io.ReadAll(r.Body)
 	if err != nil || len(body) == 0 {
@@ -59,11 +58,11 @@ func (h *OrderHandler) Upload(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *OrderHandler) GetUserOrders(w http.ResponseWriter, r *http.Request) {
-	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	principal, ok := requestPrincipal(w, r)
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
+	userID := principal.UserID
 
 	orders, err := h.service.GetOrdersByUser(r.Context(), userID)
 	if err != nil {
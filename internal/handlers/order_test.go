@@ -2,7 +2,6 @@ package handlers_test
 
 import (
 	"bytes"
-	"context"
 	"github.com/divanov-web/gophermart/internal/config"
 	"github.com/divanov-web/gophermart/internal/handlers"
 	"github.com/divanov-web/gophermart/internal/middleware"
@@ -86,7 +85,7 @@ func TestOrderUploadHandler(t *testing.T) {
 			r := chi.NewRouter()
 			r.Use(func(next http.Handler) http.Handler {
 				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-					ctx := context.WithValue(r.Context(), middleware.UserKey, int64(42))
+					ctx := middleware.WithPrincipal(r.Context(), middleware.Principal{UserID: 42})
 					next.ServeHTTP(w, r.WithContext(ctx))
 				})
 			})
@@ -100,3 +99,21 @@ func TestOrderUploadHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestOrderHandler_WithoutPrincipal(t *testing.T) {
+	logger := zaptest.NewLogger(t).Sugar()
+	orderRepo := new(mocks.MockOrderRepo)
+	svc := service.NewOrderService(orderRepo, new(mocks.MockUserRepo), logger, &config.Config{})
+	handler := handlers.NewOrderHandler(svc, logger)
+
+	// маршрут без RequireAuth: обработчик отвечает 401, а не паникует
+	r := chi.NewRouter()
+	r.Get("/api/user/orders", handler.GetUserOrders)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/user/orders", nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	orderRepo.AssertNotCalled(t, "GetByUserID", mock.Anything, mock.Anything)
+}
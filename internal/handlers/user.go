@@ -3,24 +3,29 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
+	"io"
+	"net"
 	"net/http"
 	"strconv"
 
 	"github.com/divanov-web/gophermart/internal/config"
 	"github.com/divanov-web/gophermart/internal/middleware"
 	"github.com/divanov-web/gophermart/internal/service"
+	"github.com/go-chi/chi/v5"
 	"go.uber.org/zap"
 )
 
 type UserHandler struct {
 	UserService *service.UserService
+	AuthService *service.AuthService
 	Logger      *zap.SugaredLogger
 	Config      *config.Config
 }
 
-func NewUserHandler(userService *service.UserService, logger *zap.SugaredLogger, config *config.Config) *UserHandler {
+func NewUserHandler(userService *service.UserService, authService *service.AuthService, logger *zap.SugaredLogger, config *config.Config) *UserHandler {
 	return &UserHandler{
 		UserService: userService,
+		AuthService: authService,
 		Logger:      logger,
 		Config:      config,
 	}
@@ -37,10 +42,10 @@ type RegisterRequest struct {
 
 // Test для проверки авторизации
 func (h *UserHandler) Test(w http.ResponseWriter, r *http.Request) {
-	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	principal, ok := middleware.PrincipalFromContext(r.Context())
 	msg := "anonymous"
 	if ok {
-		msg = "User ID = " + strconv.FormatInt(userID, 10)
+		msg = "User ID = " + strconv.FormatInt(principal.UserID, 10)
 	}
 	result := DataResponse{Result: msg}
 
@@ -63,8 +68,13 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 	user, err := h.UserService.Register(r.Context(), req.Login, req.Password)
 	switch {
 	case err == nil:
-		_ = middleware.SetLoginCookie(w, user.ID, h.Config.AuthSecret)
-		w.WriteHeader(http.StatusOK)
+		tokens, err := h.login(r, user.ID)
+		if err != nil {
+			h.Logger.Errorw("failed to issue tokens", "error", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		h.writeTokens(w, tokens)
 	case errors.Is(err, service.ErrLoginTaken):
 		http.Error(w, "login already in use", http.StatusConflict)
 	default:
@@ -91,11 +101,132 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := middleware.SetLoginCookie(w, user.ID, h.Config.AuthSecret); err != nil {
-		h.Logger.Errorw("failed to set cookie", "error", err)
+	tokens, err := h.login(r, user.ID)
+	if err != nil {
+		h.Logger.Errorw("failed to issue tokens", "error", err)
 		http.Error(w, "failed to login", http.StatusInternalServerError)
 		return
 	}
 
+	h.writeTokens(w, tokens)
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Refresh обмен refresh-токена на новую пару: POST /api/user/token/refresh.
+// Токен берётся из тела запроса, а если его там нет — из cookie
+func (h *UserHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	// пустое тело допустимо: браузер присылает токен в cookie
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if req.RefreshToken == "" {
+		req.RefreshToken = middleware.RefreshTokenFromCookie(r)
+	}
+
+	tokens, err := h.AuthService.Refresh(r.Context(), req.RefreshToken)
+	switch {
+	case err == nil:
+	case errors.Is(err, service.ErrInvalidRefreshToken), errors.Is(err, service.ErrRefreshTokenReused):
+		http.Error(w, "invalid refresh token", http.StatusUnauthorized)
+		return
+	default:
+		h.Logger.Errorw("failed to refresh tokens", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeTokens(w, tokens)
+}
+
+// login открывает сессию и выдаёт пользователю новую пару токенов
+func (h *UserHandler) login(r *http.Request, userID int64) (*service.TokenPair, error) {
+	meta := service.SessionMeta{
+		UserAgent: r.UserAgent(),
+		IP:        clientIP(r),
+	}
+	return h.AuthService.IssueTokens(r.Context(), userID, meta)
+}
+
+// writeTokens отдаёт пару токенов всеми способами сразу: браузеру — в cookie,
+// остальным клиентам — в заголовке Authorization и в теле ответа
+func (h *UserHandler) writeTokens(w http.ResponseWriter, tokens *service.TokenPair) {
+	middleware.SetAuthCookies(w, tokens.AccessToken, tokens.AccessExpiresAt, tokens.RefreshToken, tokens.RefreshExpiresAt)
+	middleware.SetAuthHeader(w, tokens.AccessToken)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(tokens); err != nil {
+		h.Logger.Errorw("failed to encode tokens", "error", err)
+	}
+}
+
+// Logout завершает текущую сессию: POST /api/user/logout
+func (h *UserHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requestPrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.AuthService.Logout(r.Context(), principal.UserID, principal.SessionID); err != nil {
+		h.Logger.Errorw("failed to logout", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	middleware.ClearAuthCookies(w)
+	w.WriteHeader(http.StatusOK)
+}
+
+// GetSessions действующие сессии пользователя: GET /api/user/sessions
+func (h *UserHandler) GetSessions(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requestPrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	sessions, err := h.AuthService.ListSessions(r.Context(), principal.UserID, principal.SessionID)
+	if err != nil {
+		h.Logger.Errorw("failed to list sessions", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(sessions); err != nil {
+		h.Logger.Errorw("failed to encode sessions", "error", err)
+	}
+}
+
+// DeleteSession завершает сессию на другом устройстве: DELETE /api/user/sessions/{id}
+func (h *UserHandler) DeleteSession(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requestPrincipal(w, r)
+	if !ok {
+		return
+	}
+	userID := principal.UserID
+
+	err := h.AuthService.RevokeSession(r.Context(), userID, chi.URLParam(r, "id"))
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, service.ErrSessionNotFound):
+		http.Error(w, "session not found", http.StatusNotFound)
+	default:
+		h.Logger.Errorw("failed to revoke session", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}
+}
+
+// clientIP адрес клиента без порта
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
 }
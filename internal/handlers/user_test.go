@@ -2,11 +2,15 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"github.com/divanov-web/gophermart/internal/config"
+	"github.com/divanov-web/gophermart/internal/keyring"
+	"github.com/divanov-web/gophermart/internal/middleware"
 	"github.com/divanov-web/gophermart/internal/mocks"
 	"github.com/divanov-web/gophermart/internal/model"
+	"github.com/divanov-web/gophermart/internal/repository"
 	"github.com/divanov-web/gophermart/internal/service"
 	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
@@ -16,16 +20,35 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 const testSecret = "test-secret"
 
+func testAuthConfig() *config.Config {
+	return &config.Config{
+		AuthSecret:      testSecret,
+		AccessTokenTTL:  15 * time.Minute,
+		RefreshTokenTTL: 24 * time.Hour,
+		SessionCacheTTL: time.Minute,
+	}
+}
+
+// newTestAuthService сервис токенов, сохранение сессий и refresh-токенов в котором всегда успешно
+func newTestAuthService() *service.AuthService {
+	tokenRepo := new(mocks.MockTokenRepo)
+	tokenRepo.On("Create", mock.Anything, mock.AnythingOfType("*model.RefreshToken")).Return(nil).Maybe()
+	sessionRepo := new(mocks.MockSessionRepo)
+	sessionRepo.On("Create", mock.Anything, mock.AnythingOfType("*model.Session")).Return(nil).Maybe()
+	return service.NewAuthService(tokenRepo, sessionRepo, keyring.NewStatic(testSecret), zap.NewNop().Sugar(), testAuthConfig())
+}
+
 func TestRegisterHandler_Success(t *testing.T) {
 	repo := new(mocks.MockUserRepo)
 	svc := service.NewUserService(repo)
 	logger := zap.NewNop().Sugar()
 	cfg := &config.Config{AuthSecret: testSecret}
-	handler := NewUserHandler(svc, logger, cfg)
+	handler := NewUserHandler(svc, newTestAuthService(), logger, cfg)
 
 	login := "testuser"
 	password := "123456"
@@ -54,6 +77,65 @@ func TestRegisterHandler_Success(t *testing.T) {
 		}
 	}
 	assert.True(t, cookieFound, "auth_token cookie not set")
+
+	var tokens service.TokenPair
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&tokens))
+	assert.NotEmpty(t, tokens.AccessToken)
+	assert.Equal(t, "Bearer "+tokens.AccessToken, res.Header.Get("Authorization"))
+}
+
+func TestRefreshHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		cookie     string
+		rotateErr  error
+		wantStatus int
+	}{
+		{name: "token in body", body: `{"refresh_token":"old-token"}`, wantStatus: http.StatusOK},
+		{name: "token in cookie", cookie: "old-token", wantStatus: http.StatusOK},
+		{name: "reused token", body: `{"refresh_token":"old-token"}`, rotateErr: repository.ErrRefreshTokenReused, wantStatus: http.StatusUnauthorized},
+		{name: "unknown token", body: `{"refresh_token":"old-token"}`, rotateErr: repository.ErrRefreshTokenInvalid, wantStatus: http.StatusUnauthorized},
+		{name: "no token", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokenRepo := new(mocks.MockTokenRepo)
+			authService := service.NewAuthService(tokenRepo, new(mocks.MockSessionRepo), keyring.NewStatic(testSecret), zap.NewNop().Sugar(), testAuthConfig())
+			handler := NewUserHandler(service.NewUserService(new(mocks.MockUserRepo)), authService, zap.NewNop().Sugar(), &config.Config{AuthSecret: testSecret})
+
+			tokenRepo.On("Rotate", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("*model.RefreshToken"), mock.Anything).
+				Run(func(args mock.Arguments) {
+					args.Get(2).(*model.RefreshToken).UserID = 7
+					args.Get(2).(*model.RefreshToken).FamilyID = "session-1"
+				}).
+				Return("session-1", tt.rotateErr).Maybe()
+
+			req := httptest.NewRequest(http.MethodPost, "/api/user/token/refresh", bytes.NewBufferString(tt.body))
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: "refresh_token", Value: tt.cookie})
+			}
+			trw := httptest.NewRecorder()
+			handler.Refresh(trw, req)
+
+			res := trw.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.wantStatus, res.StatusCode)
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var tokens service.TokenPair
+			assert.NoError(t, json.NewDecoder(res.Body).Decode(&tokens))
+			assert.NotEmpty(t, tokens.AccessToken)
+			assert.NotEqual(t, "old-token", tokens.RefreshToken)
+			assert.WithinDuration(t, time.Now().Add(15*time.Minute), tokens.AccessExpiresAt, time.Minute)
+			tokenRepo.AssertCalled(t, "Rotate", mock.Anything, mock.MatchedBy(func(hash string) bool {
+				return hash != "old-token" && len(hash) == 64
+			}), mock.Anything, mock.Anything)
+		})
+	}
 }
 
 func TestRegisterHandler_LoginTaken(t *testing.T) {
@@ -61,7 +143,7 @@ func TestRegisterHandler_LoginTaken(t *testing.T) {
 	svc := service.NewUserService(repo)
 	logger := zap.NewNop().Sugar()
 	cfg := &config.Config{AuthSecret: testSecret}
-	handler := NewUserHandler(svc, logger, cfg)
+	handler := NewUserHandler(svc, newTestAuthService(), logger, cfg)
 
 	login := "testuser"
 	password := "123456"
@@ -88,7 +170,7 @@ func TestLoginHandler_Success(t *testing.T) {
 	svc := service.NewUserService(repo)
 	logger := zap.NewNop().Sugar()
 	cfg := &config.Config{AuthSecret: testSecret}
-	handler := NewUserHandler(svc, logger, cfg)
+	handler := NewUserHandler(svc, newTestAuthService(), logger, cfg)
 
 	login := "testuser"
 	password := "123456"
@@ -115,7 +197,7 @@ func TestLoginHandler_InvalidCredentials(t *testing.T) {
 	svc := service.NewUserService(repo)
 	logger := zap.NewNop().Sugar()
 	cfg := &config.Config{AuthSecret: testSecret}
-	handler := NewUserHandler(svc, logger, cfg)
+	handler := NewUserHandler(svc, newTestAuthService(), logger, cfg)
 
 	login := "testuser"
 	correctHash, _ := bcrypt.GenerateFromPassword([]byte("correctpass"), bcrypt.DefaultCost)
@@ -135,3 +217,183 @@ func TestLoginHandler_InvalidCredentials(t *testing.T) {
 
 	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
 }
+
+func TestLogoutHandler_RevokesSession(t *testing.T) {
+	tokenRepo := new(mocks.MockTokenRepo)
+	tokenRepo.On("Create", mock.Anything, mock.AnythingOfType("*model.RefreshToken")).Return(nil)
+	sessionRepo := new(mocks.MockSessionRepo)
+	sessionRepo.On("Create", mock.Anything, mock.AnythingOfType("*model.Session")).Return(nil)
+	// после первой проверки активность берётся из кэша, после выхода — сразу false
+	sessionRepo.On("IsActive", mock.Anything, mock.AnythingOfType("string"), mock.Anything).Return(true, nil).Once()
+	sessionRepo.On("Revoke", mock.Anything, int64(7), mock.AnythingOfType("string"), mock.Anything).Return(nil).Once()
+
+	keys := keyring.NewStatic(testSecret)
+	authService := service.NewAuthService(tokenRepo, sessionRepo, keys, zap.NewNop().Sugar(), testAuthConfig())
+	handler := NewUserHandler(service.NewUserService(new(mocks.MockUserRepo)), authService, zap.NewNop().Sugar(), testAuthConfig())
+
+	r := chi.NewRouter()
+	r.Use(middleware.WithAuth(keys, authService))
+	r.With(middleware.RequireAuth).Post("/api/user/logout", handler.Logout)
+	r.Post("/api/user/test", handler.Test)
+
+	tokens, err := authService.IssueTokens(context.Background(), 7, service.SessionMeta{})
+	assert.NoError(t, err)
+
+	do := func(path string) *http.Response {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.AddCookie(&http.Cookie{Name: "auth_token", Value: tokens.AccessToken})
+		trw := httptest.NewRecorder()
+		r.ServeHTTP(trw, req)
+		return trw.Result()
+	}
+
+	res := do("/api/user/test")
+	var body DataResponse
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+	res.Body.Close()
+	assert.Equal(t, "User ID = 7", body.Result)
+
+	res = do("/api/user/logout")
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	res = do("/api/user/logout")
+	res.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode, "access token must be rejected after logout")
+	sessionRepo.AssertExpectations(t)
+}
+
+func TestDeleteSessionHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		revokeErr  error
+		wantStatus int
+	}{
+		{name: "revoked", wantStatus: http.StatusNoContent},
+		{name: "foreign or unknown session", revokeErr: repository.ErrSessionNotFound, wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessionRepo := new(mocks.MockSessionRepo)
+			sessionRepo.On("Revoke", mock.Anything, int64(7), "other-session", mock.Anything).Return(tt.revokeErr)
+			authService := service.NewAuthService(new(mocks.MockTokenRepo), sessionRepo, keyring.NewStatic(testSecret), zap.NewNop().Sugar(), testAuthConfig())
+			handler := NewUserHandler(service.NewUserService(new(mocks.MockUserRepo)), authService, zap.NewNop().Sugar(), testAuthConfig())
+
+			r := chi.NewRouter()
+			r.Delete("/api/user/sessions/{id}", handler.DeleteSession)
+
+			req := httptest.NewRequest(http.MethodDelete, "/api/user/sessions/other-session", nil)
+			req = req.WithContext(middleware.WithPrincipal(req.Context(), middleware.Principal{UserID: 7}))
+			trw := httptest.NewRecorder()
+			r.ServeHTTP(trw, req)
+
+			res := trw.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.wantStatus, res.StatusCode)
+		})
+	}
+}
+
+func TestWithAuth_Transports(t *testing.T) {
+	sessionRepo := new(mocks.MockSessionRepo)
+	sessionRepo.On("Create", mock.Anything, mock.AnythingOfType("*model.Session")).Return(nil)
+	sessionRepo.On("IsActive", mock.Anything, mock.AnythingOfType("string"), mock.Anything).Return(true, nil)
+	tokenRepo := new(mocks.MockTokenRepo)
+	tokenRepo.On("Create", mock.Anything, mock.AnythingOfType("*model.RefreshToken")).Return(nil)
+
+	keys := keyring.NewStatic(testSecret)
+	authService := service.NewAuthService(tokenRepo, sessionRepo, keys, zap.NewNop().Sugar(), testAuthConfig())
+	handler := NewUserHandler(service.NewUserService(new(mocks.MockUserRepo)), authService, zap.NewNop().Sugar(), testAuthConfig())
+
+	r := chi.NewRouter()
+	r.Use(middleware.WithAuth(keys, authService))
+	r.Post("/api/user/test", handler.Test)
+
+	tokens, err := authService.IssueTokens(context.Background(), 7, service.SessionMeta{})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		header string
+		cookie string
+		want   string
+	}{
+		{name: "bearer header", header: "Bearer " + tokens.AccessToken, want: "User ID = 7"},
+		{name: "lowercase scheme", header: "bearer " + tokens.AccessToken, want: "User ID = 7"},
+		{name: "cookie", cookie: tokens.AccessToken, want: "User ID = 7"},
+		{name: "other scheme", header: "Basic dXNlcjpwYXNz", cookie: tokens.AccessToken, want: "anonymous"},
+		{name: "invalid bearer does not fall back to cookie", header: "Bearer garbage", cookie: tokens.AccessToken, want: "anonymous"},
+		{name: "no credentials", want: "anonymous"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/user/test", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: "auth_token", Value: tt.cookie})
+			}
+			trw := httptest.NewRecorder()
+			r.ServeHTTP(trw, req)
+
+			res := trw.Result()
+			defer res.Body.Close()
+			var body DataResponse
+			assert.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+			assert.Equal(t, tt.want, body.Result)
+		})
+	}
+}
+
+func TestNewHandler_RequireAuth(t *testing.T) {
+	middleware.SetLogger(zap.NewNop().Sugar())
+	logger := zap.NewNop().Sugar()
+	cfg := testAuthConfig()
+
+	sessionRepo := new(mocks.MockSessionRepo)
+	sessionRepo.On("Create", mock.Anything, mock.AnythingOfType("*model.Session")).Return(nil)
+	sessionRepo.On("IsActive", mock.Anything, mock.AnythingOfType("string"), mock.Anything).Return(true, nil)
+	tokenRepo := new(mocks.MockTokenRepo)
+	tokenRepo.On("Create", mock.Anything, mock.AnythingOfType("*model.RefreshToken")).Return(nil)
+
+	keys := keyring.NewStatic(testSecret)
+	authService := service.NewAuthService(tokenRepo, sessionRepo, keys, logger, cfg)
+	userRepo := new(mocks.MockUserRepo)
+	orderService := service.NewOrderService(new(mocks.MockOrderRepo), userRepo, logger, cfg)
+	h := NewHandler(service.NewUserService(userRepo), authService, keys, orderService, nil, nil, nil, logger, cfg)
+
+	tokens, err := authService.IssueTokens(context.Background(), 7, service.SessionMeta{})
+	assert.NoError(t, err)
+	sessionRepo.On("ListActive", mock.Anything, int64(7), mock.Anything).Return([]model.Session{{ID: "other"}}, nil)
+
+	// без токена обработчики не вызываются: моки репозиториев упали бы на неожиданном вызове
+	for _, route := range []struct{ method, path string }{
+		{http.MethodGet, "/api/user/orders"},
+		{http.MethodPost, "/api/user/orders"},
+		{http.MethodGet, "/api/user/balance"},
+		{http.MethodGet, "/api/user/balance/history"},
+		{http.MethodGet, "/api/user/withdrawals"},
+		{http.MethodPost, "/api/user/balance/withdraw"},
+		{http.MethodPost, "/api/user/logout"},
+		{http.MethodGet, "/api/user/sessions"},
+		{http.MethodDelete, "/api/user/sessions/other"},
+	} {
+		req := httptest.NewRequest(route.method, route.path, nil)
+		trw := httptest.NewRecorder()
+		h.Router.ServeHTTP(trw, req)
+		assert.Equal(t, http.StatusUnauthorized, trw.Code, "%s %s", route.method, route.path)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/user/sessions", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	trw := httptest.NewRecorder()
+	h.Router.ServeHTTP(trw, req)
+	assert.Equal(t, http.StatusOK, trw.Code)
+	var sessions []service.SessionResponse
+	assert.NoError(t, json.NewDecoder(trw.Body).Decode(&sessions))
+	assert.Len(t, sessions, 1)
+	assert.False(t, sessions[0].Current)
+}
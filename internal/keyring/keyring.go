@@ -0,0 +1,269 @@
+package keyring
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+// Допустимые алгоритмы подписи JWT; остальные (в том числе none) отклоняются при проверке
+const (
+	AlgHS256 = "HS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// MinSecretLength минимальная длина HS256-секрета в байтах: не короче выхода SHA-256 (RFC 7518, 3.2)
+const MinSecretLength = 32
+
+// DefaultKeyID kid ключа из AUTH_SECRET. Токенами без заголовка kid (выпущенными до появления
+// связки ключей) считается подписанным этот ключ
+const DefaultKeyID = "default"
+
+var (
+	ErrUnknownKey   = errors.New("unknown signing key")
+	ErrAlgMismatch  = errors.New("token algorithm does not match key")
+	ErrNoSigningKey = errors.New("active key has no signing material")
+	ErrShortSecret  = fmt.Errorf("HS256 secret is shorter than %d bytes", MinSecretLength)
+)
+
+// File формат файла ключей AUTH_KEYS_FILE. Подписывает ключ active, остальные ключи
+// выведены из оборота и только проверяют ранее выданные токены
+type File struct {
+	Active string    `json:"active"`
+	Keys   []KeySpec `json:"keys"`
+}
+
+// KeySpec описание ключа: для HS256 — secret, для EdDSA — private_key (PKCS#8 PEM)
+// или, для выведенного ключа, только public_key (PEM)
+type KeySpec struct {
+	KID        string `json:"kid"`
+	Alg        string `json:"alg"`
+	Secret     string `json:"secret,omitempty"`
+	PrivateKey string `json:"private_key,omitempty"`
+	PublicKey  string `json:"public_key,omitempty"`
+}
+
+type key struct {
+	alg    string
+	sign   crypto.PrivateKey // nil у выведенного ключа без закрытой части
+	verify interface{}
+}
+
+// keySet неизменяемый снимок связки, подменяется целиком при перезагрузке
+type keySet struct {
+	active string
+	keys   map[string]key
+}
+
+// Keyring подписывает JWT активным ключом и проверяет их по kid любым известным ключом.
+// Связка из файла перечитывается без перезапуска: так новый ключ сначала раскатывается
+// как выведенный, потом становится активным, а старый удаляется после истечения его токенов
+type Keyring struct {
+	set    atomic.Pointer[keySet]
+	parser *jwt.Parser
+
+	path    string
+	modTime time.Time
+	size    int64
+	logger  *zap.SugaredLogger
+}
+
+// NewStatic связка из одного HS256-ключа DefaultKeyID, без перезагрузки. Длину секрета не проверяет,
+// чтобы сервер запускался с секретом по умолчанию при разработке; проверка — ValidateSecret
+func NewStatic(secret string) *Keyring {
+	k := newKeyring()
+	k.set.Store(&keySet{
+		active: DefaultKeyID,
+		keys: map[string]key{
+			DefaultKeyID: {alg: AlgHS256, sign: []byte(secret), verify: []byte(secret)},
+		},
+	})
+	return k
+}
+
+// Load связка из JSON-файла path; Reload и StartReloadWorker перечитывают тот же файл
+func Load(path string, logger *zap.SugaredLogger) (*Keyring, error) {
+	k := newKeyring()
+	k.path = path
+	k.logger = logger
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func newKeyring() *Keyring {
+	return &Keyring{
+		parser: jwt.NewParser(jwt.WithValidMethods([]string{AlgHS256, AlgEdDSA})),
+	}
+}
+
+// ActiveKeyID kid ключа, которым подписываются новые токены
+func (k *Keyring) ActiveKeyID() string {
+	return k.set.Load().active
+}
+
+// Sign подписывает claims активным ключом и проставляет его kid в заголовок
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	set := k.set.Load()
+	active := set.keys[set.active]
+
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(active.alg), claims)
+	token.Header["kid"] = set.active
+	return token.SignedString(active.sign)
+}
+
+// Parse проверяет подпись токена ключом из его kid и разбирает claims.
+// Алгоритм токена должен совпадать с алгоритмом ключа, иначе открытый EdDSA-ключ
+// можно было бы использовать как HMAC-секрет
+func (k *Keyring) Parse(tokenString string) (*jwt.Token, error) {
+	set := k.set.Load()
+	return k.parser.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			kid = DefaultKeyID
+		}
+		key, ok := set.keys[kid]
+		if !ok {
+			return nil, ErrUnknownKey
+		}
+		if token.Method.Alg() != key.alg {
+			return nil, ErrAlgMismatch
+		}
+		return key.verify, nil
+	})
+}
+
+// Reload перечитывает файл ключей. При ошибке продолжает работать прежняя связка
+func (k *Keyring) Reload() error {
+	info, err := os.Stat(k.path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(k.path)
+	if err != nil {
+		return err
+	}
+
+	var file File
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("parse keys file %s: %w", k.path, err)
+	}
+	set, err := buildSet(file)
+	if err != nil {
+		return fmt.Errorf("keys file %s: %w", k.path, err)
+	}
+
+	k.set.Store(set)
+	k.modTime = info.ModTime()
+	k.size = info.Size()
+	return nil
+}
+
+// StartReloadWorker Создаёт горутину, перечитывает файл ключей при его изменении
+func (k *Keyring) StartReloadWorker(ctx context.Context, wg *sync.WaitGroup, interval time.Duration) {
+	if k.path == "" {
+		return
+	}
+	ticker := time.NewTicker(interval)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				info, err := os.Stat(k.path)
+				if err != nil {
+					k.logger.Errorw("failed to stat JWT keys file", "path", k.path, "error", err)
+					continue
+				}
+				if info.ModTime().Equal(k.modTime) && info.Size() == k.size {
+					continue
+				}
+				if err := k.Reload(); err != nil {
+					k.logger.Errorw("failed to reload JWT keys, keeping previous keys", "error", err)
+					continue
+				}
+				k.logger.Infow("JWT keys reloaded", "active", k.ActiveKeyID())
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// ValidateSecret ErrShortSecret, если секрет слишком короткий для подписи HS256
+func ValidateSecret(secret string) error {
+	if len(secret) < MinSecretLength {
+		return ErrShortSecret
+	}
+	return nil
+}
+
+func buildSet(file File) (*keySet, error) {
+	set := &keySet{active: file.Active, keys: make(map[string]key, len(file.Keys))}
+	for _, spec := range file.Keys {
+		if spec.KID == "" {
+			return nil, errors.New("key without kid")
+		}
+		if _, dup := set.keys[spec.KID]; dup {
+			return nil, fmt.Errorf("duplicate kid %q", spec.KID)
+		}
+		key, err := parseKey(spec)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", spec.KID, err)
+		}
+		set.keys[spec.KID] = key
+	}
+
+	active, ok := set.keys[set.active]
+	if !ok {
+		return nil, fmt.Errorf("active key %q not found", set.active)
+	}
+	if active.sign == nil {
+		return nil, ErrNoSigningKey
+	}
+	return set, nil
+}
+
+func parseKey(spec KeySpec) (key, error) {
+	switch spec.Alg {
+	case AlgHS256:
+		if err := ValidateSecret(spec.Secret); err != nil {
+			return key{}, err
+		}
+		return key{alg: AlgHS256, sign: []byte(spec.Secret), verify: []byte(spec.Secret)}, nil
+	case AlgEdDSA:
+		if spec.PrivateKey != "" {
+			private, err := jwt.ParseEdPrivateKeyFromPEM([]byte(spec.PrivateKey))
+			if err != nil {
+				return key{}, err
+			}
+			edPrivate, ok := private.(ed25519.PrivateKey)
+			if !ok {
+				return key{}, errors.New("private_key is not an Ed25519 key")
+			}
+			return key{alg: AlgEdDSA, sign: edPrivate, verify: edPrivate.Public()}, nil
+		}
+		public, err := jwt.ParseEdPublicKeyFromPEM([]byte(spec.PublicKey))
+		if err != nil {
+			return key{}, err
+		}
+		return key{alg: AlgEdDSA, verify: public}, nil
+	default:
+		return key{}, fmt.Errorf("unsupported alg %q, want %s or %s", spec.Alg, AlgHS256, AlgEdDSA)
+	}
+}
@@ -0,0 +1,141 @@
+package keyring_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/divanov-web/gophermart/internal/keyring"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func writeKeys(t *testing.T, path string, file keyring.File) {
+	t.Helper()
+	data, err := json.Marshal(file)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+}
+
+func edKeyPEM(t *testing.T) (private, public string, raw ed25519.PublicKey) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	require.NoError(t, err)
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})),
+		pub
+}
+
+func TestKeyring_Rotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	oldKey := keyring.KeySpec{KID: "2026-09", Alg: keyring.AlgHS256, Secret: "old-secret-0123456789abcdef0123456789"}
+	writeKeys(t, path, keyring.File{Active: "2026-09", Keys: []keyring.KeySpec{oldKey}})
+
+	keys, err := keyring.Load(path, zap.NewNop().Sugar())
+	require.NoError(t, err)
+	oldToken, err := keys.Sign(jwt.MapClaims{"user_id": 1})
+	require.NoError(t, err)
+
+	// новый ключ становится активным, старый остаётся для проверки
+	private, _, _ := edKeyPEM(t)
+	newKey := keyring.KeySpec{KID: "2026-10", Alg: keyring.AlgEdDSA, PrivateKey: private}
+	writeKeys(t, path, keyring.File{Active: "2026-10", Keys: []keyring.KeySpec{newKey, oldKey}})
+	require.NoError(t, keys.Reload())
+	assert.Equal(t, "2026-10", keys.ActiveKeyID())
+
+	newToken, err := keys.Sign(jwt.MapClaims{"user_id": 1})
+	require.NoError(t, err)
+	parsed, err := keys.Parse(newToken)
+	require.NoError(t, err)
+	assert.Equal(t, "2026-10", parsed.Header["kid"])
+	assert.Equal(t, keyring.AlgEdDSA, parsed.Method.Alg())
+	_, err = keys.Parse(oldToken)
+	assert.NoError(t, err, "token of retired key must still verify")
+
+	// выведенный ключ удалён — его токены больше не принимаются
+	writeKeys(t, path, keyring.File{Active: "2026-10", Keys: []keyring.KeySpec{newKey}})
+	require.NoError(t, keys.Reload())
+	_, err = keys.Parse(oldToken)
+	assert.ErrorIs(t, err, keyring.ErrUnknownKey)
+	_, err = keys.Parse(newToken)
+	assert.NoError(t, err)
+}
+
+func TestKeyring_InvalidReloadKeepsKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	key := keyring.KeySpec{KID: "k1", Alg: keyring.AlgHS256, Secret: "secret-0123456789abcdef0123456789"}
+	writeKeys(t, path, keyring.File{Active: "k1", Keys: []keyring.KeySpec{key}})
+
+	keys, err := keyring.Load(path, zap.NewNop().Sugar())
+	require.NoError(t, err)
+	token, err := keys.Sign(jwt.MapClaims{"user_id": 1})
+	require.NoError(t, err)
+
+	_, public, _ := edKeyPEM(t)
+	bad := []keyring.File{
+		{Active: "k1", Keys: []keyring.KeySpec{{KID: "k1", Alg: "RS256", Secret: key.Secret}}},
+		{Active: "k1", Keys: []keyring.KeySpec{{KID: "k1", Alg: keyring.AlgHS256, Secret: "dev-secret-key"}}},
+		{Active: "k2", Keys: []keyring.KeySpec{key}},
+		{Active: "k1", Keys: []keyring.KeySpec{key, key}},
+		{Active: "k2", Keys: []keyring.KeySpec{key, {KID: "k2", Alg: keyring.AlgEdDSA, PublicKey: public}}},
+	}
+	for _, file := range bad {
+		writeKeys(t, path, file)
+		assert.Error(t, keys.Reload())
+	}
+
+	assert.Equal(t, "k1", keys.ActiveKeyID())
+	_, err = keys.Parse(token)
+	assert.NoError(t, err)
+}
+
+func TestKeyring_RejectsForeignAlgorithms(t *testing.T) {
+	keys := keyring.NewStatic("secret")
+
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": 1}).SignedString([]byte("secret"))
+	require.NoError(t, err)
+	_, err = keys.Parse(legacy)
+	assert.NoError(t, err, "token without kid is verified by the default key")
+
+	none := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{"user_id": 1})
+	none.Header["kid"] = keyring.DefaultKeyID
+	noneToken, err := none.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+	_, err = keys.Parse(noneToken)
+	assert.Error(t, err)
+
+	hs384 := jwt.NewWithClaims(jwt.SigningMethodHS384, jwt.MapClaims{"user_id": 1})
+	hs384.Header["kid"] = keyring.DefaultKeyID
+	hs384Token, err := hs384.SignedString([]byte("secret"))
+	require.NoError(t, err)
+	_, err = keys.Parse(hs384Token)
+	assert.Error(t, err)
+}
+
+func TestKeyring_RejectsPublicKeyAsHMACSecret(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	private, _, public := edKeyPEM(t)
+	writeKeys(t, path, keyring.File{Active: "ed", Keys: []keyring.KeySpec{{KID: "ed", Alg: keyring.AlgEdDSA, PrivateKey: private}}})
+	keys, err := keyring.Load(path, zap.NewNop().Sugar())
+	require.NoError(t, err)
+
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": 1})
+	forged.Header["kid"] = "ed"
+	forgedToken, err := forged.SignedString([]byte(public))
+	require.NoError(t, err)
+
+	_, err = keys.Parse(forgedToken)
+	assert.True(t, errors.Is(err, keyring.ErrAlgMismatch), "got %v", err)
+}
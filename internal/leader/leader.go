@@ -0,0 +1,173 @@
+package leader
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"expvar"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// JobsKey ключ advisory lock лидера фоновых задач, которые должны работать на одной реплике
+const JobsKey int64 = 0x676d5f6c6472 // "gm_ldr"
+
+// stats метрики лидерства в expvar: <name>_is_leader (0/1) и <name>_transitions
+var stats = expvar.NewMap("leader")
+
+// StartFunc запускает группу воркеров; воркеры регистрируются в wg и завершаются по отмене ctx,
+// как Start*Worker сервисов
+type StartFunc func(ctx context.Context, wg *sync.WaitGroup)
+
+// Elector выбирает лидера среди реплик через сессионный pg_try_advisory_lock.
+// Блокировка живёт, пока открыто выделенное соединение: при падении реплики
+// или обрыве соединения Postgres снимает её сам, и лидером становится другая реплика
+type Elector struct {
+	db       *sql.DB
+	key      int64
+	name     string
+	interval time.Duration
+	logger   *zap.SugaredLogger
+	leader   atomic.Bool
+}
+
+// New элекция с именем name (для логов и метрик) по ключу key; interval — период попыток захвата
+// блокировки и проверки соединения лидера
+func New(db *sql.DB, name string, key int64, interval time.Duration, logger *zap.SugaredLogger) *Elector {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	e := &Elector{
+		db:       db,
+		key:      key,
+		name:     name,
+		interval: interval,
+		logger:   logger,
+	}
+	stats.Set(name+"_is_leader", new(expvar.Int))
+	stats.Set(name+"_transitions", new(expvar.Int))
+	return e
+}
+
+// IsLeader true, пока реплика держит блокировку
+func (e *Elector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// Run блокируется до отмены ctx. Став лидером, запускает группу воркеров через start;
+// при потере лидерства или остановке отменяет их контекст и дожидается завершения
+func (e *Elector) Run(ctx context.Context, start StartFunc) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	var (
+		conn *sql.Conn
+		stop func()
+	)
+	defer func() {
+		if conn == nil {
+			return
+		}
+		stop()
+		e.release(conn)
+		e.setLeader(false)
+		e.logger.Infow("Leadership released", "name", e.name)
+	}()
+
+	for {
+		if conn == nil {
+			conn = e.tryAcquire(ctx)
+			if conn != nil {
+				e.setLeader(true)
+				e.logger.Infow("Leadership acquired", "name", e.name)
+				stop = startGroup(ctx, start)
+			}
+		} else if _, err := conn.ExecContext(ctx, "SELECT 1"); err != nil && ctx.Err() == nil {
+			// соединение с блокировкой потеряно — вместе с ним потеряно и лидерство
+			e.logger.Warnw("Leadership lost", "name", e.name, "error", err)
+			stop()
+			e.discard(conn)
+			conn = nil
+			e.setLeader(false)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// tryAcquire берёт из пула отдельное соединение и пытается захватить на нём блокировку.
+// Возвращает соединение, если блокировка получена
+func (e *Elector) tryAcquire(ctx context.Context) *sql.Conn {
+	conn, err := e.db.Conn(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			e.logger.Errorw("Leader election: failed to get connection", "name", e.name, "error", err)
+		}
+		return nil
+	}
+
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", e.key).Scan(&acquired); err != nil {
+		if ctx.Err() == nil {
+			e.logger.Errorw("Leader election: lock query failed", "name", e.name, "error", err)
+		}
+		e.discard(conn)
+		return nil
+	}
+	if !acquired {
+		_ = conn.Close()
+		return nil
+	}
+	return conn
+}
+
+// release снимает блокировку и возвращает соединение в пул
+func (e *Elector) release(conn *sql.Conn) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", e.key); err != nil {
+		e.logger.Errorw("Leader election: unlock failed", "name", e.name, "error", err)
+		e.discard(conn)
+		return
+	}
+	_ = conn.Close()
+}
+
+// discard закрывает соединение вместо возврата в пул, чтобы сессионная блокировка
+// не осталась висеть на соединении, которое возьмёт кто-то другой
+func (e *Elector) discard(conn *sql.Conn) {
+	_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+	_ = conn.Close()
+}
+
+func (e *Elector) setLeader(leader bool) {
+	e.leader.Store(leader)
+
+	var v int64
+	if leader {
+		v = 1
+	}
+	if m, ok := stats.Get(e.name + "_is_leader").(*expvar.Int); ok {
+		m.Set(v)
+	}
+	stats.Add(e.name+"_transitions", 1)
+}
+
+// startGroup запускает воркеры с собственным контекстом и возвращает функцию их остановки
+func startGroup(ctx context.Context, start StartFunc) func() {
+	groupCtx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	start(groupCtx, &wg)
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
@@ -0,0 +1,192 @@
+package leader_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/divanov-web/gophermart/internal/leader"
+	"go.uber.org/zap"
+)
+
+// fakeLocks сессионные advisory lock «сервера» Postgres, общие для всех подключений
+type fakeLocks struct {
+	mu    sync.Mutex
+	owner map[int64]*fakeConn
+}
+
+func newFakeDB(locks *fakeLocks, broken *atomic.Bool) *sql.DB {
+	return sql.OpenDB(&fakeConnector{locks: locks, broken: broken})
+}
+
+type fakeConnector struct {
+	locks  *fakeLocks
+	broken *atomic.Bool
+}
+
+func (c *fakeConnector) Connect(context.Context) (driver.Conn, error) {
+	return &fakeConn{c: c}, nil
+}
+
+func (c *fakeConnector) Driver() driver.Driver { return nil }
+
+type fakeConn struct {
+	c *fakeConnector
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c *fakeConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+// Close конец сессии снимает все её блокировки
+func (c *fakeConn) Close() error {
+	c.c.locks.mu.Lock()
+	defer c.c.locks.mu.Unlock()
+	for key, owner := range c.c.locks.owner {
+		if owner == c {
+			delete(c.c.locks.owner, key)
+		}
+	}
+	return nil
+}
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if !strings.Contains(query, "pg_try_advisory_lock") {
+		return nil, errors.New("unexpected query " + query)
+	}
+	key := args[0].Value.(int64)
+
+	c.c.locks.mu.Lock()
+	defer c.c.locks.mu.Unlock()
+	owner, held := c.c.locks.owner[key]
+	acquired := !held || owner == c
+	if acquired {
+		c.c.locks.owner[key] = c
+	}
+	return &boolRows{value: acquired}, nil
+}
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	switch {
+	case query == "SELECT 1":
+		if c.c.broken.Load() {
+			return nil, driver.ErrBadConn
+		}
+	case strings.Contains(query, "pg_advisory_unlock"):
+		key := args[0].Value.(int64)
+		c.c.locks.mu.Lock()
+		if c.c.locks.owner[key] == c {
+			delete(c.c.locks.owner, key)
+		}
+		c.c.locks.mu.Unlock()
+	default:
+		return nil, errors.New("unexpected query " + query)
+	}
+	return driver.RowsAffected(0), nil
+}
+
+type boolRows struct {
+	value bool
+	done  bool
+}
+
+func (r *boolRows) Columns() []string { return []string{"locked"} }
+func (r *boolRows) Close() error      { return nil }
+func (r *boolRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = r.value
+	return nil
+}
+
+// countingGroup считает запущенные группы воркеров
+type countingGroup struct {
+	running atomic.Int32
+	started atomic.Int32
+}
+
+func (g *countingGroup) start(ctx context.Context, wg *sync.WaitGroup) {
+	g.started.Add(1)
+	g.running.Add(1)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-ctx.Done()
+		g.running.Add(-1)
+	}()
+}
+
+func eventually(t *testing.T, cond func() bool, msg string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal(msg)
+}
+
+func TestElector_SingleLeaderAndFailover(t *testing.T) {
+	locks := &fakeLocks{owner: make(map[int64]*fakeConn)}
+	var broken atomic.Bool
+	logger := zap.NewNop().Sugar()
+
+	first := leader.New(newFakeDB(locks, &broken), "test_failover", leader.JobsKey, 10*time.Millisecond, logger)
+	second := leader.New(newFakeDB(locks, &broken), "test_failover", leader.JobsKey, 10*time.Millisecond, logger)
+	var firstGroup, secondGroup countingGroup
+
+	firstCtx, stopFirst := context.WithCancel(context.Background())
+	firstDone := make(chan struct{})
+	go func() {
+		first.Run(firstCtx, firstGroup.start)
+		close(firstDone)
+	}()
+	eventually(t, first.IsLeader, "first replica did not become leader")
+
+	secondCtx, stopSecond := context.WithCancel(context.Background())
+	defer stopSecond()
+	go second.Run(secondCtx, secondGroup.start)
+
+	time.Sleep(50 * time.Millisecond)
+	if second.IsLeader() || secondGroup.started.Load() != 0 {
+		t.Fatal("second replica must not lead while first holds the lock")
+	}
+
+	stopFirst()
+	<-firstDone
+	if first.IsLeader() || firstGroup.running.Load() != 0 {
+		t.Fatal("first replica workers must be stopped after Run returns")
+	}
+
+	eventually(t, second.IsLeader, "second replica did not take over leadership")
+	eventually(t, func() bool { return secondGroup.running.Load() == 1 }, "second replica workers not started")
+}
+
+func TestElector_ConnectionLossStopsWorkers(t *testing.T) {
+	locks := &fakeLocks{owner: make(map[int64]*fakeConn)}
+	var broken atomic.Bool
+
+	e := leader.New(newFakeDB(locks, &broken), "test_conn_loss", leader.JobsKey, 10*time.Millisecond, zap.NewNop().Sugar())
+	var group countingGroup
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.Run(ctx, group.start)
+	eventually(t, e.IsLeader, "elector did not become leader")
+
+	broken.Store(true)
+	eventually(t, func() bool { return !e.IsLeader() && group.running.Load() == 0 }, "workers still running after connection loss")
+
+	broken.Store(false)
+	eventually(t, func() bool { return e.IsLeader() && group.started.Load() == 2 }, "leadership not re-acquired")
+}
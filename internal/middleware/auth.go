@@ -3,65 +3,147 @@ package middleware
 import (
 	"context"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/divanov-web/gophermart/internal/keyring"
+	"github.com/divanov-web/gophermart/internal/model"
 	"github.com/golang-jwt/jwt/v5"
 )
 
 const (
-	authCookieName = "auth_token"
+	authCookieName    = "auth_token"
+	refreshCookieName = "refresh_token"
+	// refreshCookiePath refresh-токен браузер отправляет только на эндпоинты токенов
+	refreshCookiePath = "/api/user/token"
+
+	bearerPrefix = "Bearer "
 )
 
 type contextKey string
 
-const UserKey contextKey = "user_id"
+// SessionChecker проверяет, что сессия токена (claim jti) не завершена
+type SessionChecker interface {
+	SessionActive(ctx context.Context, sessionID string) (bool, error)
+}
 
-// WithAuth добавляет user_id в контекст, если токен валиден
-func WithAuth(secret string) func(http.Handler) http.Handler {
+// WithAuth добавляет Principal в контекст, если токен подписан ключом из keys
+// и его сессия не отозвана. Токен берётся из заголовка Authorization: Bearer, а без заголовка — из cookie
+func WithAuth(keys *keyring.Keyring, sessions SessionChecker) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			cookie, err := r.Cookie(authCookieName)
-			if err == nil {
-				token, err := jwt.Parse(cookie.Value, func(token *jwt.Token) (interface{}, error) {
-					return []byte(secret), nil
-				})
-				if err == nil && token.Valid {
-					if claims, ok := token.Claims.(jwt.MapClaims); ok {
-						if userIDFloat, ok := claims["user_id"].(float64); ok {
-							userID := int64(userIDFloat)
-							ctx := context.WithValue(r.Context(), UserKey, userID)
-							r = r.WithContext(ctx)
-						}
-					}
-				}
+			if principal, ok := authenticate(r, keys, sessions); ok {
+				r = r.WithContext(WithPrincipal(r.Context(), principal))
 			}
 			next.ServeHTTP(w, r)
 		})
 	}
 }
 
-// SetLoginCookie устанавливает токен с user_id
-func SetLoginCookie(w http.ResponseWriter, userID int64, secret string) error {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": userID,
-		"exp":     time.Now().Add(365 * 24 * time.Hour).Unix(),
-	})
-	signed, err := token.SignedString([]byte(secret))
+// authenticate единая проверка access-токена для заголовка и cookie
+func authenticate(r *http.Request, keys *keyring.Keyring, sessions SessionChecker) (Principal, bool) {
+	raw := accessToken(r)
+	if raw == "" {
+		return Principal{}, false
+	}
+	token, err := keys.Parse(raw)
+	if err != nil || !token.Valid {
+		return Principal{}, false
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return Principal{}, false
+	}
+	userIDFloat, okUser := claims["user_id"].(float64)
+	sessionID, okSession := claims["jti"].(string)
+	if !okUser || !okSession || !sessionActive(r.Context(), sessions, sessionID) {
+		return Principal{}, false
+	}
+	return Principal{
+		UserID:    int64(userIDFloat),
+		SessionID: sessionID,
+		Roles:     rolesClaim(claims),
+	}, true
+}
+
+// rolesClaim роли из claim roles; токены без него выданы до появления ролей и принадлежат обычным пользователям
+func rolesClaim(claims jwt.MapClaims) []string {
+	raw, ok := claims["roles"].([]interface{})
+	if !ok {
+		return []string{model.RoleUser}
+	}
+	roles := make([]string, 0, len(raw))
+	for _, v := range raw {
+		if role, ok := v.(string); ok {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// accessToken токен из Authorization: Bearer; заголовок с другой схемой не подменяется cookie
+func accessToken(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); header != "" {
+		if len(header) > len(bearerPrefix) && strings.EqualFold(header[:len(bearerPrefix)], bearerPrefix) {
+			return strings.TrimSpace(header[len(bearerPrefix):])
+		}
+		return ""
+	}
+	cookie, err := r.Cookie(authCookieName)
 	if err != nil {
-		return err
+		return ""
 	}
+	return cookie.Value
+}
+
+// sessionActive при ошибке проверки запрос считается неавторизованным
+func sessionActive(ctx context.Context, sessions SessionChecker, sessionID string) bool {
+	active, err := sessions.SessionActive(ctx, sessionID)
+	if err != nil {
+		if sugar != nil {
+			sugar.Errorw("session check failed", "error", err)
+		}
+		return false
+	}
+	return active
+}
+
+// SetAuthCookies устанавливает cookie с access-токеном и refresh-токеном, время жизни cookie совпадает с токенами
+func SetAuthCookies(w http.ResponseWriter, accessToken string, accessExpiresAt time.Time, refreshToken string, refreshExpiresAt time.Time) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     authCookieName,
-		Value:    signed,
+		Value:    accessToken,
 		Path:     "/",
+		Expires:  accessExpiresAt,
 		HttpOnly: true,
 		SameSite: http.SameSiteLaxMode,
 	})
-	return nil
+	http.SetCookie(w, &http.Cookie{
+		Name:     refreshCookieName,
+		Value:    refreshToken,
+		Path:     refreshCookiePath,
+		Expires:  refreshExpiresAt,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// SetAuthHeader возвращает access-токен в заголовке Authorization для клиентов без cookie
+func SetAuthHeader(w http.ResponseWriter, accessToken string) {
+	w.Header().Set("Authorization", bearerPrefix+accessToken)
+}
+
+// RefreshTokenFromCookie refresh-токен из cookie, пустая строка если cookie нет
+func RefreshTokenFromCookie(r *http.Request) string {
+	cookie, err := r.Cookie(refreshCookieName)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
 }
 
-// GetUserIDFromContext достаёт user_id из контекста
-func GetUserIDFromContext(ctx context.Context) (int64, bool) {
-	userID, ok := ctx.Value(UserKey).(int64)
-	return userID, ok
+// ClearAuthCookies удаляет cookie с токенами при выходе
+func ClearAuthCookies(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{Name: authCookieName, Path: "/", MaxAge: -1, HttpOnly: true})
+	http.SetCookie(w, &http.Cookie{Name: refreshCookieName, Path: refreshCookiePath, MaxAge: -1, HttpOnly: true})
 }
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"slices"
+)
+
+const PrincipalKey contextKey = "principal"
+
+// Principal аутентифицированный пользователь запроса
+type Principal struct {
+	UserID    int64
+	SessionID string
+	Roles     []string
+}
+
+// HasRole проверка наличия у пользователя роли
+func (p Principal) HasRole(role string) bool {
+	return slices.Contains(p.Roles, role)
+}
+
+// WithPrincipal кладёт принципала в контекст запроса
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, PrincipalKey, p)
+}
+
+// PrincipalFromContext принципал запроса; ok == false — запрос анонимный
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(PrincipalKey).(Principal)
+	return p, ok
+}
+
+// RequireAuth отвечает 401 на запросы без принципала; ставится после WithAuth
+func RequireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := PrincipalFromContext(r.Context()); !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
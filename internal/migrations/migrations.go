@@ -0,0 +1,323 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// lockKey ключ pg_advisory_lock: миграции одновременно выполняет только одна реплика
+const lockKey int64 = 0x676d5f6d6967 // "gm_mig"
+
+var (
+	ErrSchemaBehind    = errors.New("database schema is behind, run `gophermart migrate up`")
+	ErrUnknownVersion  = errors.New("database schema has migrations unknown to this binary")
+	ErrMissingDownFile = errors.New("migration has no down file")
+)
+
+var fileNameRe = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration пара файлов NNNN_name.up.sql / NNNN_name.down.sql
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status состояние одной миграции в БД
+type Status struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt *time.Time
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+	logger     *zap.SugaredLogger
+}
+
+func NewMigrator(db *sql.DB, logger *zap.SugaredLogger) (*Migrator, error) {
+	migrations, err := load(files)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{
+		db:         db,
+		migrations: migrations,
+		logger:     logger,
+	}, nil
+}
+
+// load читает встроенные файлы миграций и сортирует их по версии
+func load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, "sql")
+	if err != nil {
+		return nil, fmt.Errorf("read migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, e := range entries {
+		m := fileNameRe.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, fmt.Errorf("bad migration file name %q", e.Name())
+		}
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad migration version %q: %w", e.Name(), err)
+		}
+		body, err := fs.ReadFile(fsys, "sql/"+e.Name())
+		if err != nil {
+			return nil, fmt.Errorf("read migration %q: %w", e.Name(), err)
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		}
+		if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has different names: %q and %q", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// withLock выполняет fn на отдельном соединении, удерживая advisory lock миграций
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("get connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer func() {
+		// блокировка сессионная: снимаем её даже если контекст уже отменён
+		if _, err := conn.ExecContext(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1)", lockKey); err != nil {
+			m.logger.Errorw("failed to release migration lock", "error", err)
+		}
+	}()
+
+	if _, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    bigint PRIMARY KEY,
+			name       text        NOT NULL,
+			applied_at timestamptz NOT NULL DEFAULT now()
+		)`); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	return fn(conn)
+}
+
+func appliedVersions(ctx context.Context, q interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}) (map[int64]time.Time, error) {
+	rows, err := q.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var (
+			version   int64
+			appliedAt time.Time
+		)
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// readApplied читает применённые версии без блокировки и DDL: проверка схемы не ждёт мигрирующую
+// реплику и не требует прав на создание таблиц. Отсутствие schema_migrations — ни одной применённой миграции
+func (m *Migrator) readApplied(ctx context.Context) (map[int64]time.Time, error) {
+	var exists bool
+	if err := m.db.QueryRowContext(ctx, "SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists); err != nil {
+		return nil, fmt.Errorf("check schema_migrations: %w", err)
+	}
+	if !exists {
+		return map[int64]time.Time{}, nil
+	}
+	return appliedVersions(ctx, m.db)
+}
+
+// apply выполняет sql миграции и отметку в schema_migrations в одной транзакции
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, mig Migration, up bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	body := mig.Up
+	if !up {
+		body = mig.Down
+	}
+	if _, err := tx.ExecContext(ctx, body); err != nil {
+		return err
+	}
+
+	if up {
+		_, err = tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", mig.Version, mig.Name)
+	} else {
+		_, err = tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = $1", mig.Version)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Up применяет все неприменённые миграции, возвращает их число.
+// Если БД мигрирована более новой версией сервиса, ничего не применяет и возвращает ErrUnknownVersion
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	count := 0
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := m.checkKnown(applied); err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			if err := m.apply(ctx, conn, mig, true); err != nil {
+				return fmt.Errorf("migration %04d_%s up: %w", mig.Version, mig.Name, err)
+			}
+			m.logger.Infow("Migration applied", "version", mig.Version, "name", mig.Name)
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Down откатывает steps последних применённых миграций
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	count := 0
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && count < steps; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+			if mig.Down == "" {
+				return fmt.Errorf("%w: %04d_%s", ErrMissingDownFile, mig.Version, mig.Name)
+			}
+			if err := m.apply(ctx, conn, mig, false); err != nil {
+				return fmt.Errorf("migration %04d_%s down: %w", mig.Version, mig.Name, err)
+			}
+			m.logger.Infow("Migration rolled back", "version", mig.Version, "name", mig.Name)
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Status список известных миграций с отметкой о применении
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.readApplied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return m.status(applied), nil
+}
+
+func (m *Migrator) status(applied map[int64]time.Time) []Status {
+	result := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		s := Status{Version: mig.Version, Name: mig.Name}
+		if at, ok := applied[mig.Version]; ok {
+			s.Applied = true
+			s.AppliedAt = &at
+		}
+		result = append(result, s)
+	}
+	return result
+}
+
+// Check возвращает ErrSchemaBehind, если в БД применены не все миграции (или таблицы schema_migrations нет),
+// и ErrUnknownVersion, если БД мигрирована более новой версией сервиса. Схему только читает
+func (m *Migrator) Check(ctx context.Context) error {
+	applied, err := m.readApplied(ctx)
+	if err != nil {
+		return err
+	}
+	return m.check(applied)
+}
+
+func (m *Migrator) check(applied map[int64]time.Time) error {
+	if err := m.checkKnown(applied); err != nil {
+		return err
+	}
+	pending := 0
+	for _, mig := range m.migrations {
+		if _, ok := applied[mig.Version]; !ok {
+			pending++
+		}
+	}
+	if pending > 0 {
+		return fmt.Errorf("%w: %d pending", ErrSchemaBehind, pending)
+	}
+	return nil
+}
+
+// checkKnown ErrUnknownVersion, если в БД есть версии, которых нет среди миграций этой сборки
+func (m *Migrator) checkKnown(applied map[int64]time.Time) error {
+	known := make(map[int64]bool, len(m.migrations))
+	for _, mig := range m.migrations {
+		known[mig.Version] = true
+	}
+	for version := range applied {
+		if !known[version] {
+			return fmt.Errorf("%w: version %d", ErrUnknownVersion, version)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package migrations
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad_Embedded(t *testing.T) {
+	migrations, err := load(files)
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	for i, mig := range migrations {
+		assert.Equal(t, int64(i+1), mig.Version, "versions must be contiguous")
+		assert.NotEmpty(t, mig.Up, "migration %d has no up", mig.Version)
+		assert.NotEmpty(t, mig.Down, "migration %d has no down", mig.Version)
+	}
+}
+
+func TestLoad_BadFiles(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+	}{
+		{
+			name: "bad name",
+			fsys: fstest.MapFS{"sql/init.up.sql": {Data: []byte("SELECT 1")}},
+		},
+		{
+			name: "down without up",
+			fsys: fstest.MapFS{"sql/0001_init.down.sql": {Data: []byte("SELECT 1")}},
+		},
+		{
+			name: "name mismatch",
+			fsys: fstest.MapFS{
+				"sql/0001_init.up.sql":    {Data: []byte("SELECT 1")},
+				"sql/0001_other.down.sql": {Data: []byte("SELECT 1")},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := load(tt.fsys)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	m := &Migrator{migrations: []Migration{{Version: 1, Name: "init"}, {Version: 2, Name: "next"}}}
+	now := time.Now()
+
+	assert.NoError(t, m.check(map[int64]time.Time{1: now, 2: now}))
+	assert.ErrorIs(t, m.check(map[int64]time.Time{1: now}), ErrSchemaBehind)
+	assert.ErrorIs(t, m.check(map[int64]time.Time{1: now, 2: now, 3: now}), ErrUnknownVersion)
+	assert.ErrorIs(t, m.check(map[int64]time.Time{}), ErrSchemaBehind, "missing schema_migrations means nothing applied")
+
+	// Up не применяет миграции поверх схемы более новой версии, даже если своих неприменённых нет
+	assert.NoError(t, m.checkKnown(map[int64]time.Time{1: now}))
+	assert.ErrorIs(t, m.checkKnown(map[int64]time.Time{1: now, 3: now}), ErrUnknownVersion)
+
+	status := m.status(map[int64]time.Time{1: now})
+	require.Len(t, status, 2)
+	assert.True(t, status[0].Applied)
+	assert.False(t, status[1].Applied)
+}
@@ -0,0 +1,31 @@
+-- Исходная схема, которую раньше создавал gorm AutoMigrate
+CREATE TABLE IF NOT EXISTS users (
+    id         bigserial PRIMARY KEY,
+    login      text        NOT NULL,
+    password   text        NOT NULL,
+    balance    decimal     NOT NULL DEFAULT 0,
+    withdrawn  decimal     NOT NULL DEFAULT 0,
+    created_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_login ON users (login);
+
+CREATE TABLE IF NOT EXISTS orders (
+    id         bigserial PRIMARY KEY,
+    number     text        NOT NULL,
+    user_id    bigint      NOT NULL,
+    status     text        NOT NULL,
+    accrual    decimal,
+    created_at timestamptz,
+    CONSTRAINT fk_orders_user FOREIGN KEY (user_id) REFERENCES users (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_orders_number ON orders (number);
+CREATE INDEX IF NOT EXISTS idx_orders_user_id ON orders (user_id);
+
+CREATE TABLE IF NOT EXISTS withdrawals (
+    id           bigserial PRIMARY KEY,
+    user_id      bigint      NOT NULL,
+    "order"      text        NOT NULL,
+    sum          decimal     NOT NULL,
+    processed_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_withdrawals_user_id ON withdrawals (user_id);
@@ -0,0 +1,4 @@
+ALTER TABLE users ALTER COLUMN balance TYPE decimal USING balance / 100.0;
+ALTER TABLE users ALTER COLUMN withdrawn TYPE decimal USING withdrawn / 100.0;
+ALTER TABLE orders ALTER COLUMN accrual TYPE decimal USING accrual / 100.0;
+ALTER TABLE withdrawals ALTER COLUMN sum TYPE decimal USING sum / 100.0;
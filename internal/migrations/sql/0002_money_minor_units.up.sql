@@ -0,0 +1,24 @@
+-- Денежные суммы переводятся из дробных чисел в bigint-копейки.
+-- Колонки, уже имеющие тип bigint, пропускаются
+DO $$
+DECLARE
+    c record;
+BEGIN
+    FOR c IN
+        SELECT table_name, column_name
+        FROM information_schema.columns
+        WHERE table_schema = current_schema()
+          AND (table_name, column_name) IN (
+              ('users', 'balance'),
+              ('users', 'withdrawn'),
+              ('orders', 'accrual'),
+              ('withdrawals', 'sum')
+          )
+          AND data_type <> 'bigint'
+    LOOP
+        EXECUTE format(
+            'ALTER TABLE %I ALTER COLUMN %I TYPE bigint USING round(%I * 100)::bigint',
+            c.table_name, c.column_name, c.column_name
+        );
+    END LOOP;
+END $$;
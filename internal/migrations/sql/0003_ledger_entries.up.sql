@@ -0,0 +1,40 @@
+CREATE TABLE IF NOT EXISTS ledger_entries (
+    id             bigserial PRIMARY KEY,
+    transaction_id text        NOT NULL,
+    user_id        bigint      NOT NULL,
+    account        text        NOT NULL,
+    kind           text        NOT NULL,
+    amount         bigint      NOT NULL,
+    balance_after  bigint      NOT NULL,
+    order_number   text,
+    created_at     timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_transaction_id ON ledger_entries (transaction_id);
+CREATE INDEX IF NOT EXISTS idx_ledger_user_account ON ledger_entries (user_id, account);
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_order_number ON ledger_entries (order_number);
+
+-- Проводки для балансов, появившихся до журнала:
+-- начальный остаток (balance + withdrawn) и все исторические списания с нарастающим остатком.
+-- Отдельных начислений до журнала не сохранилось, поэтому все они сведены в одну проводку на дату
+-- регистрации пользователя и стоят раньше любых списаний. Итоговый balance_after точен,
+-- промежуточные — приблизительны: они завышены на начисления, полученные после списания
+CREATE TEMP TABLE ledger_backfill_users ON COMMIT DROP AS
+SELECT u.id
+FROM users u
+WHERE (u.balance <> 0 OR u.withdrawn <> 0)
+  AND NOT EXISTS (SELECT 1 FROM ledger_entries l WHERE l.user_id = u.id);
+
+INSERT INTO ledger_entries (transaction_id, user_id, account, kind, amount, balance_after, order_number, created_at)
+SELECT 'opening-' || u.id, u.id, a.account, 'ADJUSTMENT', a.sign * (u.balance + u.withdrawn), u.balance + u.withdrawn, '', u.created_at
+FROM users u
+CROSS JOIN (VALUES ('USER', 1), ('ADJUSTMENTS', -1)) AS a(account, sign)
+WHERE u.id IN (SELECT id FROM ledger_backfill_users);
+
+INSERT INTO ledger_entries (transaction_id, user_id, account, kind, amount, balance_after, order_number, created_at)
+SELECT 'backfill-w-' || w.id, w.user_id, a.account, 'WITHDRAWAL', a.sign * w.sum,
+       u.balance + u.withdrawn - SUM(w.sum) OVER (PARTITION BY w.user_id, a.account ORDER BY w.processed_at, w.id),
+       w."order", w.processed_at
+FROM withdrawals w
+JOIN users u ON u.id = w.user_id
+CROSS JOIN (VALUES ('USER', -1), ('WITHDRAWALS', 1)) AS a(account, sign)
+WHERE w.user_id IN (SELECT id FROM ledger_backfill_users);
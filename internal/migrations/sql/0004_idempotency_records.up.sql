@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS idempotency_records (
+    id           bigserial PRIMARY KEY,
+    user_id      bigint      NOT NULL,
+    key          text        NOT NULL,
+    fingerprint  text        NOT NULL,
+    status_code  bigint      NOT NULL DEFAULT 0,
+    content_type text        NOT NULL DEFAULT '',
+    body         bytea,
+    created_at   timestamptz,
+    expires_at   timestamptz NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_idempotency_user_key ON idempotency_records (user_id, key);
+CREATE INDEX IF NOT EXISTS idx_idempotency_records_expires_at ON idempotency_records (expires_at);
@@ -0,0 +1,21 @@
+-- Исторические дубли списаний по одному заказу не удаляются автоматически:
+-- миграция останавливается с их перечнем, какое списание оставить, решает оператор
+DO $$
+DECLARE
+    report text;
+BEGIN
+    SELECT string_agg(format('order %s: %s withdrawals (users %s)', d."order", d.cnt, d.users), '; ' ORDER BY d."order")
+    INTO report
+    FROM (
+        SELECT "order", COUNT(*) AS cnt, string_agg(DISTINCT user_id::text, ',') AS users
+        FROM withdrawals
+        GROUP BY "order"
+        HAVING COUNT(*) > 1
+    ) d;
+
+    IF report IS NOT NULL THEN
+        RAISE EXCEPTION 'duplicate withdrawals found, resolve them before adding unique index: %', report;
+    END IF;
+END $$;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_withdrawals_order ON withdrawals ("order");
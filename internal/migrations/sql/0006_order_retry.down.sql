@@ -0,0 +1,9 @@
+-- STUCK существует только вместе с колонками попыток: возвращаем такие заказы в работу
+UPDATE orders SET status = 'NEW' WHERE status = 'STUCK';
+
+DROP INDEX IF EXISTS idx_orders_status;
+DROP INDEX IF EXISTS idx_orders_next_check_at;
+
+ALTER TABLE orders DROP COLUMN IF EXISTS last_error;
+ALTER TABLE orders DROP COLUMN IF EXISTS next_check_at;
+ALTER TABLE orders DROP COLUMN IF EXISTS attempts;
@@ -0,0 +1,6 @@
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS attempts bigint NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS next_check_at timestamptz;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS last_error text NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_orders_next_check_at ON orders (next_check_at);
+CREATE INDEX IF NOT EXISTS idx_orders_status ON orders (status);
@@ -0,0 +1,2 @@
+ALTER TABLE orders DROP COLUMN IF EXISTS lease_until;
+ALTER TABLE orders DROP COLUMN IF EXISTS lease_owner;
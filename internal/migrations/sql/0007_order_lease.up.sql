@@ -0,0 +1,2 @@
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS lease_owner text NOT NULL DEFAULT '';
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS lease_until timestamptz;
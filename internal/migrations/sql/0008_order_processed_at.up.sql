@@ -0,0 +1,7 @@
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS processed_at timestamptz;
+
+-- для уже обработанных заказов точное время неизвестно, берём время загрузки
+UPDATE orders SET processed_at = created_at
+WHERE status IN ('PROCESSED', 'INVALID') AND processed_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_orders_user_created ON orders (user_id, created_at DESC);
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id         bigserial PRIMARY KEY,
+    user_id    bigint      NOT NULL REFERENCES users (id),
+    family_id  text        NOT NULL,
+    token_hash text        NOT NULL,
+    created_at timestamptz,
+    expires_at timestamptz NOT NULL,
+    used_at    timestamptz,
+    revoked_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_refresh_tokens_token_hash ON refresh_tokens (token_hash);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens (user_id);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens (family_id);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_expires_at ON refresh_tokens (expires_at);
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS sessions (
+    id           text PRIMARY KEY,
+    user_id      bigint      NOT NULL REFERENCES users (id),
+    user_agent   text        NOT NULL DEFAULT '',
+    ip           text        NOT NULL DEFAULT '',
+    created_at   timestamptz,
+    last_seen_at timestamptz NOT NULL,
+    expires_at   timestamptz NOT NULL,
+    revoked_at   timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id);
+CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions (expires_at);
+
+-- действующие цепочки refresh-токенов становятся сессиями, чтобы пользователи не разлогинились
+INSERT INTO sessions (id, user_id, created_at, last_seen_at, expires_at)
+SELECT family_id, user_id, min(created_at), max(created_at), max(expires_at)
+FROM refresh_tokens
+WHERE revoked_at IS NULL
+GROUP BY family_id, user_id
+ON CONFLICT (id) DO NOTHING;
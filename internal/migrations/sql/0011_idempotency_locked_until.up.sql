@@ -0,0 +1,2 @@
+-- существующие незавершённые резервы сразу считаются брошенными
+ALTER TABLE idempotency_records ADD COLUMN IF NOT EXISTS locked_until timestamptz NOT NULL DEFAULT now();
@@ -0,0 +1,2 @@
+-- токен резерва: Complete и Release выполняет только запрос, занявший ключ последним
+ALTER TABLE idempotency_records ADD COLUMN IF NOT EXISTS token text NOT NULL DEFAULT '';
@@ -0,0 +1,26 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/divanov-web/gophermart/internal/accrual"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockAccrualClient struct {
+	mock.Mock
+}
+
+func (m *MockAccrualClient) SendOrder(ctx context.Context, orderNumber string) error {
+	args := m.Called(ctx, orderNumber)
+	return args.Error(0)
+}
+
+func (m *MockAccrualClient) GetOrderInfo(ctx context.Context, orderNumber string) (*accrual.AccrualResponse, error) {
+	args := m.Called(ctx, orderNumber)
+	r := args.Get(0)
+	if r == nil {
+		return nil, args.Error(1)
+	}
+	return r.(*accrual.AccrualResponse), args.Error(1)
+}
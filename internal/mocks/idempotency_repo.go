@@ -0,0 +1,57 @@
+package mocks
+
+import (
+	"context"
+	"time"
+
+	"github.com/divanov-web/gophermart/internal/model"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockIdempotencyRepo struct {
+	mock.Mock
+}
+
+func (m *MockIdempotencyRepo) Reserve(ctx context.Context, record *model.IdempotencyRecord) (bool, error) {
+	args := m.Called(ctx, record)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockIdempotencyRepo) Get(ctx context.Context, userID int64, key string) (*model.IdempotencyRecord, error) {
+	args := m.Called(ctx, userID, key)
+	r := args.Get(0)
+	if r == nil {
+		return nil, args.Error(1)
+	}
+	return r.(*model.IdempotencyRecord), args.Error(1)
+}
+
+func (m *MockIdempotencyRepo) Reclaim(ctx context.Context, record *model.IdempotencyRecord, now time.Time) (bool, error) {
+	args := m.Called(ctx, record, now)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockIdempotencyRepo) Extend(ctx context.Context, userID int64, key, token string, lockedUntil time.Time) error {
+	args := m.Called(ctx, userID, key, token, lockedUntil)
+	return args.Error(0)
+}
+
+func (m *MockIdempotencyRepo) Complete(ctx context.Context, userID int64, key, token string, statusCode int, contentType string, body []byte) error {
+	args := m.Called(ctx, userID, key, token, statusCode, contentType, body)
+	return args.Error(0)
+}
+
+func (m *MockIdempotencyRepo) Release(ctx context.Context, userID int64, key, token string) error {
+	args := m.Called(ctx, userID, key, token)
+	return args.Error(0)
+}
+
+func (m *MockIdempotencyRepo) Delete(ctx context.Context, userID int64, key string) error {
+	args := m.Called(ctx, userID, key)
+	return args.Error(0)
+}
+
+func (m *MockIdempotencyRepo) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	args := m.Called(ctx, now)
+	return args.Get(0).(int64), args.Error(1)
+}
@@ -2,6 +2,7 @@ package mocks
 
 import (
 	"context"
+	"time"
 
 	"github.com/divanov-web/gophermart/internal/model"
 	"github.com/stretchr/testify/mock"
@@ -35,7 +36,42 @@ func (m *MockOrderRepo) GetByStatus(ctx context.Context, status model.OrderStatu
 	return args.Get(0).([]model.Order), args.Error(1)
 }
 
-func (m *MockOrderRepo) Update(ctx context.Context, order *model.Order) error {
+func (m *MockOrderRepo) MarkProcessed(ctx context.Context, order *model.Order, accrual *model.Money) error {
+	args := m.Called(ctx, order, accrual)
+	return args.Error(0)
+}
+
+func (m *MockOrderRepo) MarkInvalid(ctx context.Context, order *model.Order) error {
+	args := m.Called(ctx, order)
+	return args.Error(0)
+}
+
+func (m *MockOrderRepo) ClaimDue(ctx context.Context, status model.OrderStatus, owner string, limit int, lease time.Duration) ([]model.Order, error) {
+	args := m.Called(ctx, status, owner, limit, lease)
+	return args.Get(0).([]model.Order), args.Error(1)
+}
+
+func (m *MockOrderRepo) ReleaseClaim(ctx context.Context, order *model.Order) error {
+	args := m.Called(ctx, order)
+	return args.Error(0)
+}
+
+func (m *MockOrderRepo) MarkSent(ctx context.Context, order *model.Order) error {
 	args := m.Called(ctx, order)
 	return args.Error(0)
 }
+
+func (m *MockOrderRepo) ScheduleRetry(ctx context.Context, order *model.Order, lastError string, nextCheckAt time.Time) error {
+	args := m.Called(ctx, order, lastError, nextCheckAt)
+	return args.Error(0)
+}
+
+func (m *MockOrderRepo) MarkStuck(ctx context.Context, order *model.Order, lastError string) error {
+	args := m.Called(ctx, order, lastError)
+	return args.Error(0)
+}
+
+func (m *MockOrderRepo) Requeue(ctx context.Context, number string) error {
+	args := m.Called(ctx, number)
+	return args.Error(0)
+}
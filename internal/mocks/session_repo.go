@@ -0,0 +1,38 @@
+package mocks
+
+import (
+	"context"
+	"time"
+
+	"github.com/divanov-web/gophermart/internal/model"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockSessionRepo struct {
+	mock.Mock
+}
+
+func (m *MockSessionRepo) Create(ctx context.Context, session *model.Session) error {
+	args := m.Called(ctx, session)
+	return args.Error(0)
+}
+
+func (m *MockSessionRepo) IsActive(ctx context.Context, id string, now time.Time) (bool, error) {
+	args := m.Called(ctx, id, now)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockSessionRepo) ListActive(ctx context.Context, userID int64, now time.Time) ([]model.Session, error) {
+	args := m.Called(ctx, userID, now)
+	return args.Get(0).([]model.Session), args.Error(1)
+}
+
+func (m *MockSessionRepo) Revoke(ctx context.Context, userID int64, id string, now time.Time) error {
+	args := m.Called(ctx, userID, id, now)
+	return args.Error(0)
+}
+
+func (m *MockSessionRepo) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	args := m.Called(ctx, now)
+	return args.Get(0).(int64), args.Error(1)
+}
@@ -0,0 +1,33 @@
+package mocks
+
+import (
+	"context"
+	"time"
+
+	"github.com/divanov-web/gophermart/internal/model"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockTokenRepo struct {
+	mock.Mock
+}
+
+func (m *MockTokenRepo) Create(ctx context.Context, token *model.RefreshToken) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+
+func (m *MockTokenRepo) Rotate(ctx context.Context, tokenHash string, next *model.RefreshToken, now time.Time) (string, error) {
+	args := m.Called(ctx, tokenHash, next, now)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockTokenRepo) RevokeFamily(ctx context.Context, familyID string, now time.Time) error {
+	args := m.Called(ctx, familyID, now)
+	return args.Error(0)
+}
+
+func (m *MockTokenRepo) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	args := m.Called(ctx, now)
+	return args.Get(0).(int64), args.Error(1)
+}
@@ -24,19 +24,21 @@ func (m *MockUserRepo) GetUserByLogin(ctx context.Context, login string) (*model
 	return u.(*model.User), args.Error(1)
 }
 
-func (m *MockUserRepo) IncreaseBalance(ctx context.Context, userID int64, amount float64) error {
-	return nil
+func (m *MockUserRepo) WithdrawBalance(ctx context.Context, userID int64, amount model.Money, order string) error {
+	args := m.Called(ctx, userID, amount, order)
+	return args.Error(0)
 }
 
-func (m *MockUserRepo) WithdrawBalance(ctx context.Context, userID int64, amount float64, order string) error {
-	return nil
-}
-
-func (m *MockUserRepo) GetBalance(ctx context.Context, userID int64) (float64, float64, error) {
+func (m *MockUserRepo) GetBalance(ctx context.Context, userID int64) (model.Money, model.Money, error) {
 	args := m.Called(ctx, userID)
-	return args.Get(0).(float64), args.Get(1).(float64), args.Error(2)
+	return args.Get(0).(model.Money), args.Get(1).(model.Money), args.Error(2)
 }
 
 func (m *MockUserRepo) GetWithdrawalsByUser(ctx context.Context, userID int64) ([]model.Withdrawal, error) {
 	return nil, nil
 }
+
+func (m *MockUserRepo) GetLedgerByUser(ctx context.Context, userID int64, afterID int64, limit int) ([]model.LedgerEntry, error) {
+	args := m.Called(ctx, userID, afterID, limit)
+	return args.Get(0).([]model.LedgerEntry), args.Error(1)
+}
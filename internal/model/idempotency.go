@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// IdempotencyRecord сохранённый результат запроса с заголовком Idempotency-Key.
+// StatusCode == 0 — запрос ещё выполняется; после LockedUntil такой резерв считается брошенным
+type IdempotencyRecord struct {
+	ID          int64     `gorm:"primaryKey;autoIncrement"`
+	UserID      int64     `gorm:"uniqueIndex:idx_idempotency_user_key;not null"`
+	Key         string    `gorm:"uniqueIndex:idx_idempotency_user_key;not null"`
+	Fingerprint string    `gorm:"not null"` // хэш тела запроса, чтобы не отдать чужой ответ при повторе ключа с другими данными
+	StatusCode  int       `gorm:"not null;default:0"`
+	ContentType string    `gorm:"not null;default:''"`
+	Body        []byte    `gorm:"type:bytea"`
+	CreatedAt   time.Time `gorm:"autoCreateTime"`
+	ExpiresAt   time.Time `gorm:"index;not null"`
+	LockedUntil time.Time `gorm:"not null"`            // до какого момента выполняющийся запрос держит ключ
+	Token       string    `gorm:"not null;default:''"` // токен резерва запроса, который сейчас держит ключ
+}
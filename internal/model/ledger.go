@@ -0,0 +1,36 @@
+package model
+
+import "time"
+
+// LedgerEntryKind тип операции в журнале движения баллов
+type LedgerEntryKind string
+
+const (
+	LedgerKindAccrual    LedgerEntryKind = "ACCRUAL"
+	LedgerKindWithdrawal LedgerEntryKind = "WITHDRAWAL"
+	LedgerKindAdjustment LedgerEntryKind = "ADJUSTMENT"
+)
+
+// LedgerAccount счёт проводки. Каждая операция — пара проводок с противоположными суммами:
+// счёт пользователя и системный счёт-корреспондент, поэтому сумма по транзакции всегда равна нулю
+type LedgerAccount string
+
+const (
+	LedgerAccountUser        LedgerAccount = "USER"
+	LedgerAccountAccrual     LedgerAccount = "ACCRUAL"     // источник начислений от accrual
+	LedgerAccountWithdrawals LedgerAccount = "WITHDRAWALS" // оплата заказов баллами
+	LedgerAccountAdjustments LedgerAccount = "ADJUSTMENTS" // ручные корректировки и начальные остатки
+)
+
+// LedgerEntry проводка журнала. users.balance и users.withdrawn — кэш, восстанавливаемый по проводкам счёта USER
+type LedgerEntry struct {
+	ID            int64           `gorm:"primaryKey;autoIncrement"`
+	TransactionID string          `gorm:"index;not null"`
+	UserID        int64           `gorm:"index:idx_ledger_user_account;not null"`
+	Account       LedgerAccount   `gorm:"index:idx_ledger_user_account;not null"`
+	Kind          LedgerEntryKind `gorm:"not null"`
+	Amount        Money           `gorm:"not null"` // положительная сумма — приход на счёт, отрицательная — расход
+	BalanceAfter  Money           `gorm:"not null"` // остаток счёта пользователя после операции
+	OrderNumber   string          `gorm:"index"`
+	CreatedAt     time.Time       `gorm:"autoCreateTime"`
+}
@@ -0,0 +1,131 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MoneyScale количество минорных единиц (копеек) в одном балле
+const MoneyScale = 100
+
+// moneyFracDigits знаков после запятой в минорных единицах
+const moneyFracDigits = 2
+
+var ErrInvalidMoney = errors.New("invalid money amount")
+
+// Money денежная сумма в минорных единицах (сотых долях балла).
+// В БД хранится как bigint, в JSON кодируется десятичным числом, как требует спецификация
+type Money int64
+
+// NewMoneyFromMinor сумма из минорных единиц
+func NewMoneyFromMinor(minor int64) Money {
+	return Money(minor)
+}
+
+// Minor сумма в минорных единицах
+func (m Money) Minor() int64 {
+	return int64(m)
+}
+
+// String десятичная запись без лишних нулей: 500, 500.5, 729.98
+func (m Money) String() string {
+	v := int64(m)
+	sign := ""
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	whole := v / MoneyScale
+	frac := v % MoneyScale
+	if frac == 0 {
+		return sign + strconv.FormatInt(whole, 10)
+	}
+	fracStr := strings.TrimRight(fmt.Sprintf("%0*d", moneyFracDigits, frac), "0")
+	return sign + strconv.FormatInt(whole, 10) + "." + fracStr
+}
+
+// ParseMoney разбирает десятичное число без перехода через float64.
+// Лишние знаки после запятой округляются по правилу half-up
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, ErrInvalidMoney
+	}
+
+	negative := false
+	switch s[0] {
+	case '-':
+		negative = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+
+	wholeStr, fracStr, _ := strings.Cut(s, ".")
+	if wholeStr == "" && fracStr == "" {
+		return 0, ErrInvalidMoney
+	}
+	if !isDigits(wholeStr) || !isDigits(fracStr) {
+		return 0, ErrInvalidMoney
+	}
+
+	var whole int64
+	if wholeStr != "" {
+		var err error
+		whole, err = strconv.ParseInt(wholeStr, 10, 64)
+		if err != nil || whole > (1<<63-1)/MoneyScale-1 {
+			return 0, ErrInvalidMoney
+		}
+	}
+
+	roundUp := len(fracStr) > moneyFracDigits && fracStr[moneyFracDigits] >= '5'
+	if len(fracStr) > moneyFracDigits {
+		fracStr = fracStr[:moneyFracDigits]
+	}
+	fracStr += strings.Repeat("0", moneyFracDigits-len(fracStr))
+	frac, _ := strconv.ParseInt(fracStr, 10, 64)
+
+	v := whole*MoneyScale + frac
+	if roundUp {
+		v++
+	}
+	if negative {
+		v = -v
+	}
+	return Money(v), nil
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	// некоторые клиенты присылают число строкой
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+	if strings.ContainsAny(s, "eE") {
+		return fmt.Errorf("%w: %s", ErrInvalidMoney, s)
+	}
+	v, err := ParseMoney(s)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidMoney, s)
+	}
+	*m = v
+	return nil
+}
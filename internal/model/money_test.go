@@ -0,0 +1,63 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Money
+		wantErr bool
+	}{
+		{in: "500", want: 50000},
+		{in: "500.5", want: 50050},
+		{in: "729.98", want: 72998},
+		{in: "0.01", want: 1},
+		{in: ".5", want: 50},
+		{in: "-42", want: -4200},
+		{in: "1.005", want: 101},
+		{in: "1.004", want: 100},
+		{in: "", wantErr: true},
+		{in: "abc", wantErr: true},
+		{in: "1.2.3", wantErr: true},
+		{in: ".", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseMoney(tt.in)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidMoney)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMoney_JSON(t *testing.T) {
+	type balance struct {
+		Current   Money  `json:"current"`
+		Withdrawn Money  `json:"withdrawn"`
+		Accrual   *Money `json:"accrual,omitempty"`
+	}
+
+	data, err := json.Marshal(balance{Current: 50050, Withdrawn: 4200})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"current": 500.5, "withdrawn": 42}`, string(data))
+
+	var got balance
+	require.NoError(t, json.Unmarshal([]byte(`{"current": 0.1, "withdrawn": "2", "accrual": 729.98}`), &got))
+	assert.Equal(t, Money(10), got.Current)
+	assert.Equal(t, Money(200), got.Withdrawn)
+	require.NotNil(t, got.Accrual)
+	assert.Equal(t, Money(72998), *got.Accrual)
+
+	assert.Error(t, json.Unmarshal([]byte(`{"current": 1e3}`), &got))
+}
@@ -11,6 +11,9 @@ const (
 	OrderStatusProcessing OrderStatus = "PROCESSING"
 	OrderStatusInvalid    OrderStatus = "INVALID"
 	OrderStatusProcessed  OrderStatus = "PROCESSED"
+	// OrderStatusStuck внутренний статус: accrual не смог обработать заказ за отведённые попытки,
+	// заказ ждёт ручного перезапуска оператором
+	OrderStatusStuck OrderStatus = "STUCK"
 )
 
 type Order struct {
@@ -19,6 +22,15 @@ type Order struct {
 	UserID    int64       `gorm:"index;not null" json:"-"`
 	User      User        `gorm:"foreignKey:UserID;references:ID" json:"-"`
 	Status    OrderStatus `gorm:"not null" json:"status"`
-	Accrual   *float64    `json:"accrual,omitempty"`
+	Accrual   *Money      `json:"accrual,omitempty"`
 	CreatedAt time.Time   `gorm:"autoCreateTime" json:"created_at"`
+	// ProcessedAt момент получения окончательного статуса PROCESSED или INVALID
+	ProcessedAt *time.Time `json:"processed_at,omitempty"`
+
+	Attempts    int        `gorm:"not null;default:0" json:"-"` // неудачных обращений к accrual подряд
+	NextCheckAt *time.Time `gorm:"index" json:"-"`              // раньше этого времени воркеры заказ не берут
+	LastError   string     `gorm:"not null;default:''" json:"-"`
+
+	LeaseOwner string     `gorm:"not null;default:''" json:"-"` // реплика, захватившая заказ на обработку
+	LeaseUntil *time.Time `json:"-"`                            // до этого времени заказ не выдаётся другим репликам
 }
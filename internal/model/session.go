@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// Session вход пользователя с одного устройства. ID сессии передаётся в access JWT в claim jti
+// и служит цепочкой ротаций refresh-токенов (RefreshToken.FamilyID)
+type Session struct {
+	ID         string     `gorm:"primaryKey"`
+	UserID     int64      `gorm:"index;not null"`
+	UserAgent  string     `gorm:"not null;default:''"`
+	IP         string     `gorm:"not null;default:''"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime"`
+	LastSeenAt time.Time  `gorm:"not null"` // время последнего обновления токенов
+	ExpiresAt  time.Time  `gorm:"index;not null"`
+	RevokedAt  *time.Time // сессия завершена выходом, пользователем или при повторе refresh-токена
+}
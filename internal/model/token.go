@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// RefreshToken непрозрачный refresh-токен. В БД хранится только SHA-256 от токена.
+// Токены одной цепочки ротаций имеют общий FamilyID: повторное предъявление уже
+// использованного токена отзывает всю цепочку
+type RefreshToken struct {
+	ID        int64      `gorm:"primaryKey;autoIncrement"`
+	UserID    int64      `gorm:"index;not null"`
+	FamilyID  string     `gorm:"index;not null"`
+	TokenHash string     `gorm:"uniqueIndex;not null"`
+	CreatedAt time.Time  `gorm:"autoCreateTime"`
+	ExpiresAt time.Time  `gorm:"index;not null"`
+	UsedAt    *time.Time // токен обменян на новую пару
+	RevokedAt *time.Time // цепочка отозвана
+}
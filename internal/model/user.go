@@ -2,11 +2,14 @@ package model
 
 import "time"
 
+// RoleUser роль обычного пользователя, входит в access-токен каждого вошедшего
+const RoleUser = "user"
+
 type User struct {
 	ID        int64     `gorm:"primaryKey;autoIncrement"`
 	Login     string    `gorm:"uniqueIndex;not null"`
 	Password  string    `gorm:"not null"`
-	Balance   float64   `gorm:"not null;default:0"`
-	Withdrawn float64   `gorm:"not null;default:0"`
+	Balance   Money     `gorm:"not null;default:0"`
+	Withdrawn Money     `gorm:"not null;default:0"`
 	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
 }
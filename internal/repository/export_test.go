@@ -0,0 +1,8 @@
+package repository
+
+// Экспорт пересчёта остатков по журналу для тестов пакета repository_test
+
+type KindSum = kindSum
+type LedgerTotals = ledgerTotals
+
+var UserTotals = userTotals
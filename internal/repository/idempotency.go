@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/divanov-web/gophermart/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrIdempotencyLockLost ключ занят другим запросом: резерв истёк и его забрал повтор
+var ErrIdempotencyLockLost = errors.New("idempotency key reservation lost")
+
+type IdempotencyRepository interface {
+	Reserve(ctx context.Context, record *model.IdempotencyRecord) (bool, error)
+	Get(ctx context.Context, userID int64, key string) (*model.IdempotencyRecord, error)
+	Reclaim(ctx context.Context, record *model.IdempotencyRecord, now time.Time) (bool, error)
+	Extend(ctx context.Context, userID int64, key, token string, lockedUntil time.Time) error
+	Complete(ctx context.Context, userID int64, key, token string, statusCode int, contentType string, body []byte) error
+	Release(ctx context.Context, userID int64, key, token string) error
+	Delete(ctx context.Context, userID int64, key string) error
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+type idempotencyRepo struct {
+	db *gorm.DB
+}
+
+func NewIdempotencyRepository(db *gorm.DB) IdempotencyRepository {
+	return &idempotencyRepo{db: db}
+}
+
+// Reserve занимает ключ. false — ключ уже занят другим запросом
+func (r *idempotencyRepo) Reserve(ctx context.Context, record *model.IdempotencyRecord) (bool, error) {
+	res := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(record)
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *idempotencyRepo) Get(ctx context.Context, userID int64, key string) (*model.IdempotencyRecord, error) {
+	var record model.IdempotencyRecord
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND key = ?", userID, key).
+		First(&record).Error
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// Reclaim занимает ключ, брошенный запросом, который не завершился к locked_until
+// (процесс убит, Complete не записался). false — ключ успел занять другой повтор
+func (r *idempotencyRepo) Reclaim(ctx context.Context, record *model.IdempotencyRecord, now time.Time) (bool, error) {
+	res := r.db.WithContext(ctx).
+		Model(&model.IdempotencyRecord{}).
+		Where("user_id = ? AND key = ? AND status_code = 0 AND locked_until < ?", record.UserID, record.Key, now).
+		Updates(map[string]interface{}{
+			"fingerprint":  record.Fingerprint,
+			"expires_at":   record.ExpiresAt,
+			"locked_until": record.LockedUntil,
+			"token":        record.Token,
+		})
+	return res.RowsAffected > 0, res.Error
+}
+
+// Extend продлевает резерв выполняющегося запроса, чтобы повтор не забрал ключ
+func (r *idempotencyRepo) Extend(ctx context.Context, userID int64, key, token string, lockedUntil time.Time) error {
+	res := r.db.WithContext(ctx).
+		Model(&model.IdempotencyRecord{}).
+		Where("user_id = ? AND key = ? AND token = ? AND status_code = 0", userID, key, token).
+		Update("locked_until", lockedUntil)
+	return reservationResult(res)
+}
+
+// Complete сохраняет ответ, если ключ всё ещё держит резерв token
+func (r *idempotencyRepo) Complete(ctx context.Context, userID int64, key, token string, statusCode int, contentType string, body []byte) error {
+	res := r.db.WithContext(ctx).
+		Model(&model.IdempotencyRecord{}).
+		Where("user_id = ? AND key = ? AND token = ? AND status_code = 0", userID, key, token).
+		Updates(map[string]interface{}{
+			"status_code":  statusCode,
+			"content_type": contentType,
+			"body":         body,
+		})
+	return reservationResult(res)
+}
+
+// Release удаляет незавершённый резерв token
+func (r *idempotencyRepo) Release(ctx context.Context, userID int64, key, token string) error {
+	res := r.db.WithContext(ctx).
+		Where("user_id = ? AND key = ? AND token = ? AND status_code = 0", userID, key, token).
+		Delete(&model.IdempotencyRecord{})
+	return reservationResult(res)
+}
+
+func reservationResult(res *gorm.DB) error {
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrIdempotencyLockLost
+	}
+	return nil
+}
+
+func (r *idempotencyRepo) Delete(ctx context.Context, userID int64, key string) error {
+	return r.db.WithContext(ctx).
+		Where("user_id = ? AND key = ?", userID, key).
+		Delete(&model.IdempotencyRecord{}).Error
+}
+
+func (r *idempotencyRepo) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	res := r.db.WithContext(ctx).
+		Where("expires_at < ?", now).
+		Delete(&model.IdempotencyRecord{})
+	return res.RowsAffected, res.Error
+}
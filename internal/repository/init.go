@@ -5,22 +5,18 @@ import (
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
-
-	"github.com/divanov-web/gophermart/internal/model"
 )
 
-// InitDB подключается к БД, выполняет миграции и возвращает *gorm.DB
+// InitDB подключается к БД и возвращает *gorm.DB.
+// Схема БД создаётся версионными миграциями из пакета migrations
 func InitDB(dsn string) (*gorm.DB, error) {
 	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Silent),
+		Logger:         logger.Default.LogMode(logger.Silent),
+		TranslateError: true, // нарушения уникальности приходят как gorm.ErrDuplicatedKey
 	})
 	if err != nil {
 		return nil, fmt.Errorf("gorm open: %w", err)
 	}
 
-	if err := db.AutoMigrate(&model.User{}, &model.Order{}, &model.Withdrawal{}); err != nil {
-		return nil, fmt.Errorf("auto-migrate: %w", err)
-	}
-
 	return db, nil
 }
@@ -0,0 +1,179 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/divanov-web/gophermart/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type LedgerRepository interface {
+	Reconcile(ctx context.Context, userID int64) (bool, error)
+	ReconcileAll(ctx context.Context) (int64, error)
+}
+
+type ledgerRepo struct {
+	db *gorm.DB
+}
+
+func NewLedgerRepository(db *gorm.DB) LedgerRepository {
+	return &ledgerRepo{db: db}
+}
+
+// counterAccount системный счёт-корреспондент для типа операции
+func counterAccount(kind model.LedgerEntryKind) model.LedgerAccount {
+	switch kind {
+	case model.LedgerKindAccrual:
+		return model.LedgerAccountAccrual
+	case model.LedgerKindWithdrawal:
+		return model.LedgerAccountWithdrawals
+	default:
+		return model.LedgerAccountAdjustments
+	}
+}
+
+func newTransactionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate ledger transaction id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// postEntries пишет пару проводок по уже изменённому балансу пользователя.
+// Вызывается внутри транзакции, в которой обновлён users.balance
+func postEntries(tx *gorm.DB, userID int64, kind model.LedgerEntryKind, amount model.Money, order string) error {
+	var balance model.Money
+	if err := tx.Model(&model.User{}).
+		Select("balance").
+		Where("id = ?", userID).
+		Scan(&balance).Error; err != nil {
+		return err
+	}
+
+	txID, err := newTransactionID()
+	if err != nil {
+		return err
+	}
+
+	entries := []model.LedgerEntry{
+		{
+			TransactionID: txID,
+			UserID:        userID,
+			Account:       model.LedgerAccountUser,
+			Kind:          kind,
+			Amount:        amount,
+			BalanceAfter:  balance,
+			OrderNumber:   order,
+		},
+		{
+			TransactionID: txID,
+			UserID:        userID,
+			Account:       counterAccount(kind),
+			Kind:          kind,
+			Amount:        -amount,
+			BalanceAfter:  balance,
+			OrderNumber:   order,
+		},
+	}
+	return tx.Create(&entries).Error
+}
+
+// creditUser начисляет баллы на счёт пользователя и пишет проводки в той же транзакции
+func creditUser(tx *gorm.DB, userID int64, kind model.LedgerEntryKind, amount model.Money, order string) error {
+	if err := tx.Model(&model.User{}).
+		Where("id = ?", userID).
+		Update("balance", gorm.Expr("balance + ?", amount)).
+		Error; err != nil {
+		return err
+	}
+	return postEntries(tx, userID, kind, amount, order)
+}
+
+// kindSum сумма проводок счёта USER пользователя по одному типу операции
+type kindSum struct {
+	UserID int64
+	Kind   model.LedgerEntryKind
+	Amount model.Money
+}
+
+type ledgerTotals struct {
+	Balance   model.Money
+	Withdrawn model.Money
+}
+
+// userTotals balance — сумма всех проводок счёта USER, withdrawn — сумма списаний с обратным знаком:
+// проводки списаний на счёте USER отрицательные, а users.withdrawn хранит потраченное положительным
+func userTotals(sums []kindSum) map[int64]ledgerTotals {
+	totals := make(map[int64]ledgerTotals)
+	for _, sum := range sums {
+		t := totals[sum.UserID]
+		t.Balance += sum.Amount
+		if sum.Kind == model.LedgerKindWithdrawal {
+			t.Withdrawn -= sum.Amount
+		}
+		totals[sum.UserID] = t
+	}
+	return totals
+}
+
+// Reconcile восстанавливает balance и withdrawn пользователя по журналу; true — кэш был исправлен
+func (r *ledgerRepo) Reconcile(ctx context.Context, userID int64) (bool, error) {
+	fixed, err := r.reconcile(ctx, &userID)
+	return fixed > 0, err
+}
+
+// ReconcileAll восстанавливает кэш баланса всех пользователей, возвращает число исправленных строк
+func (r *ledgerRepo) ReconcileAll(ctx context.Context) (int64, error) {
+	return r.reconcile(ctx, nil)
+}
+
+// reconcile пересчёт для одного пользователя или, при userID == nil, для всех.
+// Строки users блокируются до подсчёта проводок: начисления и списания меняют баланс
+// под той же блокировкой, поэтому пересчёт не затрёт параллельную операцию
+func (r *ledgerRepo) reconcile(ctx context.Context, userID *int64) (int64, error) {
+	var fixed int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		users := tx.Model(&model.User{}).Select("id", "balance", "withdrawn").Clauses(clause.Locking{Strength: "UPDATE"})
+		sumsQuery := tx.Model(&model.LedgerEntry{}).
+			Select("user_id, kind, SUM(amount)::bigint AS amount").
+			Where("account = ?", model.LedgerAccountUser).
+			Group("user_id, kind")
+		if userID != nil {
+			users = users.Where("id = ?", *userID)
+			sumsQuery = sumsQuery.Where("user_id = ?", *userID)
+		}
+
+		var cached []model.User
+		if err := users.Find(&cached).Error; err != nil {
+			return err
+		}
+		var sums []kindSum
+		if err := sumsQuery.Scan(&sums).Error; err != nil {
+			return err
+		}
+
+		totals := userTotals(sums)
+		for _, user := range cached {
+			want := totals[user.ID]
+			if user.Balance == want.Balance && user.Withdrawn == want.Withdrawn {
+				continue
+			}
+			if err := tx.Model(&model.User{}).
+				Where("id = ?", user.ID).
+				Updates(map[string]interface{}{
+					"balance":   want.Balance,
+					"withdrawn": want.Withdrawn,
+				}).Error; err != nil {
+				return err
+			}
+			fixed++
+		}
+		return nil
+	})
+	return fixed, err
+}
@@ -0,0 +1,30 @@
+package repository_test
+
+import (
+	"testing"
+
+	"github.com/divanov-web/gophermart/internal/model"
+	"github.com/divanov-web/gophermart/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserTotals(t *testing.T) {
+	sums := []repository.KindSum{
+		{UserID: 1, Kind: model.LedgerKindAccrual, Amount: 150_00},
+		{UserID: 1, Kind: model.LedgerKindWithdrawal, Amount: -30_50},
+		{UserID: 1, Kind: model.LedgerKindAdjustment, Amount: 5_00},
+		{UserID: 2, Kind: model.LedgerKindWithdrawal, Amount: -10_00},
+		{UserID: 2, Kind: model.LedgerKindAdjustment, Amount: 10_00},
+		{UserID: 3, Kind: model.LedgerKindAdjustment, Amount: -2_00},
+	}
+
+	got := repository.UserTotals(sums)
+
+	assert.Equal(t, map[int64]repository.LedgerTotals{
+		// списания уменьшают баланс и копятся в withdrawn положительной суммой
+		1: {Balance: 124_50, Withdrawn: 30_50},
+		2: {Balance: 0, Withdrawn: 10_00},
+		// корректировка в минус — не списание
+		3: {Balance: -2_00, Withdrawn: 0},
+	}, got)
+}
@@ -3,9 +3,19 @@ package repository
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/divanov-web/gophermart/internal/model"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrOrderNotProcessing заказ уже не в статусе PROCESSING (обработан ранее или другим воркером)
+	ErrOrderNotProcessing = errors.New("order is not in PROCESSING status")
+	ErrOrderNotStuck      = errors.New("order is not in STUCK status")
+	// ErrOrderLeaseLost аренда заказа истекла и он мог быть захвачен другой репликой
+	ErrOrderLeaseLost = errors.New("order lease lost")
 )
 
 type OrderRepository interface {
@@ -13,7 +23,14 @@ type OrderRepository interface {
 	GetByNumber(ctx context.Context, number string) (*model.Order, error)
 	GetByUserID(ctx context.Context, userID int64) ([]model.Order, error)
 	GetByStatus(ctx context.Context, status model.OrderStatus) ([]model.Order, error)
-	Update(ctx context.Context, order *model.Order) error
+	ClaimDue(ctx context.Context, status model.OrderStatus, owner string, limit int, lease time.Duration) ([]model.Order, error)
+	ReleaseClaim(ctx context.Context, order *model.Order) error
+	MarkSent(ctx context.Context, order *model.Order) error
+	MarkProcessed(ctx context.Context, order *model.Order, accrual *model.Money) error
+	MarkInvalid(ctx context.Context, order *model.Order) error
+	ScheduleRetry(ctx context.Context, order *model.Order, lastError string, nextCheckAt time.Time) error
+	MarkStuck(ctx context.Context, order *model.Order, lastError string) error
+	Requeue(ctx context.Context, number string) error
 }
 
 type orderRepo struct {
@@ -41,7 +58,7 @@ func (r *orderRepo) GetByUserID(ctx context.Context, userID int64) ([]model.Orde
 	var orders []model.Order
 	err := r.db.WithContext(ctx).
 		Where("user_id = ?", userID).
-		Order("created_at asc").
+		Order("created_at desc, id desc").
 		Find(&orders).Error
 	return orders, err
 }
@@ -54,6 +71,239 @@ func (r *orderRepo) GetByStatus(ctx context.Context, status model.OrderStatus) (
 	return orders, err
 }
 
-func (r *orderRepo) Update(ctx context.Context, order *model.Order) error {
-	return r.db.WithContext(ctx).Save(order).Error
+// ClaimDue захватывает до limit заказов в статусе status, время проверки которых наступило,
+// и сдаёт их в аренду owner на lease. Строки, заблокированные другой репликой, пропускаются
+// (FOR UPDATE SKIP LOCKED), а аренда не даёт выдать заказ повторно до её истечения.
+// Время берётся из БД, чтобы расхождение часов реплик не влияло на аренду
+func (r *orderRepo) ClaimDue(ctx context.Context, status model.OrderStatus, owner string, limit int, lease time.Duration) ([]model.Order, error) {
+	var orders []model.Order
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ?", status).
+			Where("next_check_at IS NULL OR next_check_at <= now()").
+			Where("lease_until IS NULL OR lease_until <= now()").
+			Order("id asc").
+			Limit(limit).
+			Find(&orders).Error
+		if err != nil || len(orders) == 0 {
+			return err
+		}
+
+		ids := make([]int64, len(orders))
+		for i, o := range orders {
+			ids[i] = o.ID
+		}
+		// now() постоянно в пределах транзакции, поэтому срок аренды у всей пачки одинаковый
+		var leaseUntil time.Time
+		if err := tx.Raw("SELECT now() + make_interval(secs => ?)", lease.Seconds()).Scan(&leaseUntil).Error; err != nil {
+			return err
+		}
+		err = tx.Model(&model.Order{}).
+			Where("id IN ?", ids).
+			Updates(map[string]interface{}{
+				"lease_owner": owner,
+				"lease_until": leaseUntil,
+			}).Error
+		if err != nil {
+			return err
+		}
+
+		for i := range orders {
+			orders[i].LeaseOwner = owner
+			orders[i].LeaseUntil = &leaseUntil
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// ReleaseClaim досрочно снимает аренду, чтобы заказ попал в следующий проход опроса
+func (r *orderRepo) ReleaseClaim(ctx context.Context, order *model.Order) error {
+	err := r.db.WithContext(ctx).
+		Model(&model.Order{}).
+		Where("id = ? AND lease_owner = ?", order.ID, order.LeaseOwner).
+		Updates(leaseReleased()).Error
+	if err != nil {
+		return err
+	}
+	order.LeaseOwner = ""
+	order.LeaseUntil = nil
+	return nil
+}
+
+// MarkSent переводит отправленный в accrual заказ из NEW в PROCESSING со сброшенными попытками,
+// если аренда заказа всё ещё принадлежит этой реплике
+func (r *orderRepo) MarkSent(ctx context.Context, order *model.Order) error {
+	updates := leaseReleased()
+	updates["status"] = model.OrderStatusProcessing
+	updates["attempts"] = 0
+	updates["last_error"] = ""
+	updates["next_check_at"] = nil
+
+	res := r.db.WithContext(ctx).
+		Model(&model.Order{}).
+		Where("id = ? AND status = ? AND lease_owner = ?", order.ID, model.OrderStatusNew, order.LeaseOwner).
+		Updates(updates)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrOrderLeaseLost
+	}
+
+	order.Status = model.OrderStatusProcessing
+	order.Attempts = 0
+	order.LastError = ""
+	order.NextCheckAt = nil
+	order.LeaseOwner = ""
+	order.LeaseUntil = nil
+	return nil
+}
+
+// MarkProcessed в одной транзакции переводит заказ из PROCESSING в PROCESSED и начисляет баллы пользователю.
+// Переход выполняется только если заказ ещё в PROCESSING, поэтому повторный вызов не начислит баллы дважды
+func (r *orderRepo) MarkProcessed(ctx context.Context, order *model.Order, accrual *model.Money) error {
+	processedAt := time.Now()
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&model.Order{}).
+			Where("id = ? AND status = ?", order.ID, model.OrderStatusProcessing).
+			Updates(map[string]interface{}{
+				"status":       model.OrderStatusProcessed,
+				"accrual":      accrual,
+				"processed_at": processedAt,
+				"lease_owner":  "",
+				"lease_until":  nil,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrOrderNotProcessing
+		}
+
+		if accrual != nil && *accrual > 0 {
+			if err := creditUser(tx, order.UserID, model.LedgerKindAccrual, *accrual, order.Number); err != nil {
+				return err
+			}
+		}
+
+		order.Status = model.OrderStatusProcessed
+		order.Accrual = accrual
+		order.ProcessedAt = &processedAt
+		order.LeaseOwner = ""
+		order.LeaseUntil = nil
+		return nil
+	})
+}
+
+// MarkInvalid переводит заказ из PROCESSING в INVALID. Условие на статус не даёт callback-у
+// и опросу, применяющим статусы параллельно, затереть уже начисленный PROCESSED
+func (r *orderRepo) MarkInvalid(ctx context.Context, order *model.Order) error {
+	processedAt := time.Now()
+	updates := leaseReleased()
+	updates["status"] = model.OrderStatusInvalid
+	updates["processed_at"] = processedAt
+
+	res := r.db.WithContext(ctx).
+		Model(&model.Order{}).
+		Where("id = ? AND status = ?", order.ID, model.OrderStatusProcessing).
+		Updates(updates)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrOrderNotProcessing
+	}
+
+	order.Status = model.OrderStatusInvalid
+	order.ProcessedAt = &processedAt
+	order.LeaseOwner = ""
+	order.LeaseUntil = nil
+	return nil
+}
+
+// ScheduleRetry учитывает неудачную попытку, откладывает следующую проверку заказа и снимает аренду
+func (r *orderRepo) ScheduleRetry(ctx context.Context, order *model.Order, lastError string, nextCheckAt time.Time) error {
+	updates := leaseReleased()
+	updates["attempts"] = gorm.Expr("attempts + 1")
+	updates["last_error"] = lastError
+	updates["next_check_at"] = nextCheckAt
+
+	res := r.db.WithContext(ctx).
+		Model(&model.Order{}).
+		Where("id = ? AND lease_owner = ?", order.ID, order.LeaseOwner).
+		Updates(updates)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrOrderLeaseLost
+	}
+	order.Attempts++
+	order.LastError = lastError
+	order.NextCheckAt = &nextCheckAt
+	order.LeaseOwner = ""
+	order.LeaseUntil = nil
+	return nil
+}
+
+// MarkStuck переводит заказ в STUCK, если он всё ещё в том статусе, в котором его взял воркер,
+// и аренда принадлежит этой реплике
+func (r *orderRepo) MarkStuck(ctx context.Context, order *model.Order, lastError string) error {
+	updates := leaseReleased()
+	updates["status"] = model.OrderStatusStuck
+	updates["attempts"] = gorm.Expr("attempts + 1")
+	updates["last_error"] = lastError
+	updates["next_check_at"] = nil
+
+	res := r.db.WithContext(ctx).
+		Model(&model.Order{}).
+		Where("id = ? AND status = ? AND lease_owner = ?", order.ID, order.Status, order.LeaseOwner).
+		Updates(updates)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrOrderLeaseLost
+	}
+	order.Status = model.OrderStatusStuck
+	order.Attempts++
+	order.LastError = lastError
+	order.NextCheckAt = nil
+	order.LeaseOwner = ""
+	order.LeaseUntil = nil
+	return nil
+}
+
+// Requeue возвращает зависший заказ в NEW со сброшенным счётчиком попыток
+func (r *orderRepo) Requeue(ctx context.Context, number string) error {
+	res := r.db.WithContext(ctx).
+		Model(&model.Order{}).
+		Where("number = ? AND status = ?", number, model.OrderStatusStuck).
+		Updates(map[string]interface{}{
+			"status":        model.OrderStatusNew,
+			"attempts":      0,
+			"last_error":    "",
+			"next_check_at": nil,
+			"lease_owner":   "",
+			"lease_until":   nil,
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrOrderNotStuck
+	}
+	return nil
+}
+
+// leaseReleased набор полей для снятия аренды заказа
+func leaseReleased() map[string]interface{} {
+	return map[string]interface{}{
+		"lease_owner": "",
+		"lease_until": nil,
+	}
 }
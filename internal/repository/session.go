@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/divanov-web/gophermart/internal/model"
+	"gorm.io/gorm"
+)
+
+// ErrSessionNotFound сессии нет, она чужая или уже завершена
+var ErrSessionNotFound = errors.New("session not found")
+
+type SessionRepository interface {
+	Create(ctx context.Context, session *model.Session) error
+	IsActive(ctx context.Context, id string, now time.Time) (bool, error)
+	ListActive(ctx context.Context, userID int64, now time.Time) ([]model.Session, error)
+	Revoke(ctx context.Context, userID int64, id string, now time.Time) error
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+type sessionRepo struct {
+	db *gorm.DB
+}
+
+func NewSessionRepository(db *gorm.DB) SessionRepository {
+	return &sessionRepo{db: db}
+}
+
+func (r *sessionRepo) Create(ctx context.Context, session *model.Session) error {
+	return r.db.WithContext(ctx).Create(session).Error
+}
+
+// IsActive true, если сессия существует, не завершена и не истекла
+func (r *sessionRepo) IsActive(ctx context.Context, id string, now time.Time) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).
+		Model(&model.Session{}).
+		Where("id = ? AND revoked_at IS NULL AND expires_at > ?", id, now).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// ListActive действующие сессии пользователя, недавно активные первыми
+func (r *sessionRepo) ListActive(ctx context.Context, userID int64, now time.Time) ([]model.Session, error) {
+	var sessions []model.Session
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, now).
+		Order("last_seen_at desc").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// Revoke завершает сессию пользователя и отзывает её refresh-токены
+func (r *sessionRepo) Revoke(ctx context.Context, userID int64, id string, now time.Time) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&model.Session{}).
+			Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+			Update("revoked_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrSessionNotFound
+		}
+		return revokeFamily(tx, id, now)
+	})
+}
+
+// DeleteExpired удаляет истёкшие сессии, возвращает число удалённых
+func (r *sessionRepo) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	res := r.db.WithContext(ctx).
+		Where("expires_at < ?", now).
+		Delete(&model.Session{})
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/divanov-web/gophermart/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrRefreshTokenInvalid токен не найден, истёк или его цепочка отозвана
+	ErrRefreshTokenInvalid = errors.New("refresh token is invalid")
+	// ErrRefreshTokenReused предъявлен уже использованный токен, цепочка отозвана
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+)
+
+type TokenRepository interface {
+	Create(ctx context.Context, token *model.RefreshToken) error
+	Rotate(ctx context.Context, tokenHash string, next *model.RefreshToken, now time.Time) (string, error)
+	RevokeFamily(ctx context.Context, familyID string, now time.Time) error
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+type tokenRepo struct {
+	db *gorm.DB
+}
+
+func NewTokenRepository(db *gorm.DB) TokenRepository {
+	return &tokenRepo{db: db}
+}
+
+func (r *tokenRepo) Create(ctx context.Context, token *model.RefreshToken) error {
+	return r.db.WithContext(ctx).Create(token).Error
+}
+
+// Rotate обменивает токен с хэшем tokenHash на next. next получает пользователя и цепочку старого токена.
+// Повторное предъявление использованного токена отзывает всю цепочку и возвращает ErrRefreshTokenReused.
+// Возвращает ID цепочки (он же ID сессии), в том числе вместе с ErrRefreshTokenReused
+func (r *tokenRepo) Rotate(ctx context.Context, tokenHash string, next *model.RefreshToken, now time.Time) (string, error) {
+	reused := false
+	familyID := ""
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var current model.RefreshToken
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", tokenHash).
+			First(&current).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrRefreshTokenInvalid
+		}
+		if err != nil {
+			return err
+		}
+
+		if current.RevokedAt != nil || !current.ExpiresAt.After(now) {
+			return ErrRefreshTokenInvalid
+		}
+		familyID = current.FamilyID
+		if current.UsedAt != nil {
+			// отзыв цепочки должен сохраниться, поэтому транзакция завершается успешно
+			reused = true
+			return revokeFamily(tx, current.FamilyID, now)
+		}
+
+		err = tx.Model(&model.RefreshToken{}).
+			Where("id = ?", current.ID).
+			Update("used_at", now).Error
+		if err != nil {
+			return err
+		}
+
+		next.UserID = current.UserID
+		next.FamilyID = current.FamilyID
+		if err := tx.Create(next).Error; err != nil {
+			return err
+		}
+
+		// сессия живёт, пока её продлевают ротацией
+		return tx.Model(&model.Session{}).
+			Where("id = ?", current.FamilyID).
+			Updates(map[string]interface{}{
+				"last_seen_at": now,
+				"expires_at":   next.ExpiresAt,
+			}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	if reused {
+		return familyID, ErrRefreshTokenReused
+	}
+	return familyID, nil
+}
+
+// RevokeFamily отзывает все токены цепочки и её сессию
+func (r *tokenRepo) RevokeFamily(ctx context.Context, familyID string, now time.Time) error {
+	return revokeFamily(r.db.WithContext(ctx), familyID, now)
+}
+
+// DeleteExpired удаляет истёкшие токены, возвращает число удалённых
+func (r *tokenRepo) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	res := r.db.WithContext(ctx).
+		Where("expires_at < ?", now).
+		Delete(&model.RefreshToken{})
+	return res.RowsAffected, res.Error
+}
+
+// revokeFamily отзывает все токены цепочки вместе с её сессией
+func revokeFamily(tx *gorm.DB, familyID string, now time.Time) error {
+	err := tx.Model(&model.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", now).Error
+	if err != nil {
+		return err
+	}
+	return tx.Model(&model.Session{}).
+		Where("id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", now).Error
+}
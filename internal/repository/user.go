@@ -8,16 +8,17 @@ import (
 )
 
 var (
-	ErrLowBalance = errors.New("insufficient funds")
+	ErrLowBalance       = errors.New("insufficient funds")
+	ErrWithdrawalExists = errors.New("withdrawal for this order already exists")
 )
 
 type UserRepository interface {
 	CreateUser(ctx context.Context, user *model.User) (*model.User, error)
 	GetUserByLogin(ctx context.Context, login string) (*model.User, error)
-	IncreaseBalance(ctx context.Context, userID int64, amount float64) error
-	WithdrawBalance(ctx context.Context, userID int64, amount float64, order string) error
+	WithdrawBalance(ctx context.Context, userID int64, amount model.Money, order string) error
 	GetWithdrawalsByUser(ctx context.Context, userID int64) ([]model.Withdrawal, error)
-	GetBalance(ctx context.Context, userID int64) (float64, float64, error)
+	GetBalance(ctx context.Context, userID int64) (model.Money, model.Money, error)
+	GetLedgerByUser(ctx context.Context, userID int64, afterID int64, limit int) ([]model.LedgerEntry, error)
 }
 
 type userRepo struct {
@@ -44,32 +45,21 @@ func (r *userRepo) GetUserByLogin(ctx context.Context, login string) (*model.Use
 	return &user, nil
 }
 
-func (r *userRepo) IncreaseBalance(ctx context.Context, userID int64, amount float64) error {
-	return r.db.WithContext(ctx).
-		Model(&model.User{}).
-		Where("id = ?", userID).
-		Update("balance", gorm.Expr("balance + ?", amount)).
-		Error
-}
-
-func (r *userRepo) WithdrawBalance(ctx context.Context, userID int64, amount float64, order string) error {
+// WithdrawBalance списывает баллы в счёт заказа: баланс, запись о списании и проводки журнала — одна транзакция
+func (r *userRepo) WithdrawBalance(ctx context.Context, userID int64, amount model.Money, order string) error {
 	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		var user model.User
-		if err := tx.First(&user, userID).Error; err != nil {
-			return err
-		}
-
-		if user.Balance < amount {
-			return ErrLowBalance
-		}
-
-		if err := tx.Model(&model.User{}).
-			Where("id = ?", userID).
+		// условие на остаток в самом UPDATE, чтобы параллельные списания не увели баланс в минус
+		res := tx.Model(&model.User{}).
+			Where("id = ? AND balance >= ?", userID, amount).
 			Updates(map[string]interface{}{
 				"balance":   gorm.Expr("balance - ?", amount),
 				"withdrawn": gorm.Expr("withdrawn + ?", amount),
-			}).Error; err != nil {
-			return err
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrLowBalance
 		}
 
 		withdrawal := &model.Withdrawal{
@@ -79,10 +69,13 @@ func (r *userRepo) WithdrawBalance(ctx context.Context, userID int64, amount flo
 		}
 
 		if err := tx.Create(withdrawal).Error; err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				return ErrWithdrawalExists
+			}
 			return err
 		}
 
-		return nil
+		return postEntries(tx, userID, model.LedgerKindWithdrawal, -amount, order)
 	})
 }
 
@@ -95,7 +88,7 @@ func (r *userRepo) GetWithdrawalsByUser(ctx context.Context, userID int64) ([]mo
 	return withdrawals, err
 }
 
-func (r *userRepo) GetBalance(ctx context.Context, userID int64) (float64, float64, error) {
+func (r *userRepo) GetBalance(ctx context.Context, userID int64) (model.Money, model.Money, error) {
 	var user model.User
 	err := r.db.WithContext(ctx).
 		Select("balance", "withdrawn").
@@ -106,3 +99,14 @@ func (r *userRepo) GetBalance(ctx context.Context, userID int64) (float64, float
 	}
 	return user.Balance, user.Withdrawn, nil
 }
+
+// GetLedgerByUser проводки по счёту пользователя в порядке времени, начиная после записи afterID
+func (r *userRepo) GetLedgerByUser(ctx context.Context, userID int64, afterID int64, limit int) ([]model.LedgerEntry, error) {
+	var entries []model.LedgerEntry
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND account = ? AND id > ?", userID, model.LedgerAccountUser, afterID).
+		Order("id asc").
+		Limit(limit).
+		Find(&entries).Error
+	return entries, err
+}
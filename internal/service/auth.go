@@ -0,0 +1,280 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/divanov-web/gophermart/internal/config"
+	"github.com/divanov-web/gophermart/internal/keyring"
+	"github.com/divanov-web/gophermart/internal/model"
+	"github.com/divanov-web/gophermart/internal/repository"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+	ErrSessionNotFound     = errors.New("session not found")
+)
+
+// refreshTokenBytes энтропия непрозрачного refresh-токена
+const refreshTokenBytes = 32
+
+// TokenPair выданные клиенту access- и refresh-токены
+type TokenPair struct {
+	AccessToken      string    `json:"access_token"`
+	AccessExpiresAt  time.Time `json:"access_expires_at"`
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// SessionMeta сведения об устройстве, с которого выполнен вход
+type SessionMeta struct {
+	UserAgent string
+	IP        string
+}
+
+// SessionResponse сессия в ответе GET /api/user/sessions
+type SessionResponse struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	Current    bool      `json:"current"` // сессия, из которой сделан запрос
+}
+
+// AuthService выдаёт короткоживущие access JWT, ротирует refresh-токены и ведёт сессии
+type AuthService struct {
+	repo       repository.TokenRepository
+	sessions   repository.SessionRepository
+	keys       *keyring.Keyring
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	cache      *sessionCache
+	logger     *zap.SugaredLogger
+}
+
+func NewAuthService(repo repository.TokenRepository, sessions repository.SessionRepository, keys *keyring.Keyring, logger *zap.SugaredLogger, config *config.Config) *AuthService {
+	return &AuthService{
+		repo:       repo,
+		sessions:   sessions,
+		keys:       keys,
+		accessTTL:  config.AccessTokenTTL,
+		refreshTTL: config.RefreshTokenTTL,
+		cache:      newSessionCache(config.SessionCacheTTL),
+		logger:     logger,
+	}
+}
+
+// IssueTokens открывает сессию и выдаёт пару токенов: refresh-токен начинает цепочку ротаций сессии
+func (s *AuthService) IssueTokens(ctx context.Context, userID int64, meta SessionMeta) (*TokenPair, error) {
+	sessionID, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	refresh, record, err := s.newRefreshToken(now)
+	if err != nil {
+		return nil, err
+	}
+
+	session := &model.Session{
+		ID:         sessionID,
+		UserID:     userID,
+		UserAgent:  meta.UserAgent,
+		IP:         meta.IP,
+		LastSeenAt: now,
+		ExpiresAt:  record.ExpiresAt,
+	}
+	if err := s.sessions.Create(ctx, session); err != nil {
+		return nil, err
+	}
+
+	record.UserID = userID
+	record.FamilyID = sessionID
+	if err := s.repo.Create(ctx, record); err != nil {
+		return nil, err
+	}
+
+	return s.pair(userID, sessionID, refresh, record.ExpiresAt, now)
+}
+
+// Refresh обменивает refresh-токен на новую пару. Старый токен становится недействительным,
+// а его повторное предъявление отзывает всю цепочку — так обнаруживается утечка токена
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	if refreshToken == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	now := time.Now()
+	refresh, next, err := s.newRefreshToken(now)
+	if err != nil {
+		return nil, err
+	}
+
+	familyID, err := s.repo.Rotate(ctx, hashToken(refreshToken), next, now)
+	switch {
+	case errors.Is(err, repository.ErrRefreshTokenReused):
+		// сессия отозвана вместе с цепочкой: access-токены сессии перестают работать сразу, а не через SessionCacheTTL
+		s.cache.set(familyID, false, now)
+		s.logger.Warnw("Refresh token reuse detected, token family revoked", "session", familyID)
+		return nil, ErrRefreshTokenReused
+	case errors.Is(err, repository.ErrRefreshTokenInvalid):
+		return nil, ErrInvalidRefreshToken
+	case err != nil:
+		return nil, err
+	}
+
+	return s.pair(next.UserID, next.FamilyID, refresh, next.ExpiresAt, now)
+}
+
+// SessionActive проверка, что сессия не завершена, с кэшированием результата на config.SessionCacheTTL
+func (s *AuthService) SessionActive(ctx context.Context, sessionID string) (bool, error) {
+	now := time.Now()
+	if active, ok := s.cache.get(sessionID, now); ok {
+		return active, nil
+	}
+
+	active, err := s.sessions.IsActive(ctx, sessionID, now)
+	if err != nil {
+		return false, err
+	}
+	s.cache.set(sessionID, active, now)
+	return active, nil
+}
+
+// Logout завершает текущую сессию; повторный выход не ошибка
+func (s *AuthService) Logout(ctx context.Context, userID int64, sessionID string) error {
+	err := s.RevokeSession(ctx, userID, sessionID)
+	if errors.Is(err, ErrSessionNotFound) {
+		return nil
+	}
+	return err
+}
+
+// ListSessions действующие сессии пользователя; currentID отмечает сессию запроса
+func (s *AuthService) ListSessions(ctx context.Context, userID int64, currentID string) ([]SessionResponse, error) {
+	sessions, err := s.sessions.ListActive(ctx, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	resp := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		resp = append(resp, SessionResponse{
+			ID:         session.ID,
+			UserAgent:  session.UserAgent,
+			IP:         session.IP,
+			CreatedAt:  session.CreatedAt,
+			LastSeenAt: session.LastSeenAt,
+			Current:    session.ID == currentID,
+		})
+	}
+	return resp, nil
+}
+
+// RevokeSession завершает сессию пользователя и отзывает её токены
+func (s *AuthService) RevokeSession(ctx context.Context, userID int64, sessionID string) error {
+	now := time.Now()
+	err := s.sessions.Revoke(ctx, userID, sessionID, now)
+	if errors.Is(err, repository.ErrSessionNotFound) {
+		return ErrSessionNotFound
+	}
+	if err != nil {
+		return err
+	}
+	s.cache.set(sessionID, false, now)
+	s.logger.Infow("Session revoked", "userID", userID, "session", sessionID)
+	return nil
+}
+
+// StartCleanupWorker Создаёт горутину, периодически удаляет истёкшие refresh-токены и сессии
+func (s *AuthService) StartCleanupWorker(ctx context.Context, wg *sync.WaitGroup, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				deleted, err := s.repo.DeleteExpired(ctx, time.Now())
+				if err != nil {
+					s.logger.Errorw("failed to delete expired refresh tokens", "error", err)
+					continue
+				}
+				if deleted > 0 {
+					s.logger.Infow("Expired refresh tokens deleted", "count", deleted)
+				}
+				deleted, err = s.sessions.DeleteExpired(ctx, time.Now())
+				if err != nil {
+					s.logger.Errorw("failed to delete expired sessions", "error", err)
+					continue
+				}
+				if deleted > 0 {
+					s.logger.Infow("Expired sessions deleted", "count", deleted)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// pair подписывает access JWT активным ключом связки; jti — ID сессии, по нему WithAuth проверяет отзыв
+func (s *AuthService) pair(userID int64, sessionID, refresh string, refreshExpiresAt, now time.Time) (*TokenPair, error) {
+	accessExpiresAt := now.Add(s.accessTTL)
+	access, err := s.keys.Sign(jwt.MapClaims{
+		"user_id": userID,
+		"jti":     sessionID,
+		"roles":   []string{model.RoleUser},
+		"iat":     now.Unix(),
+		"exp":     accessExpiresAt.Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:      access,
+		AccessExpiresAt:  accessExpiresAt,
+		RefreshToken:     refresh,
+		RefreshExpiresAt: refreshExpiresAt,
+	}, nil
+}
+
+// newRefreshToken случайный refresh-токен и запись для БД с его хэшем
+func (s *AuthService) newRefreshToken(now time.Time) (string, *model.RefreshToken, error) {
+	token, err := randomToken(refreshTokenBytes)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, &model.RefreshToken{
+		TokenHash: hashToken(token),
+		ExpiresAt: now.Add(s.refreshTTL),
+	}, nil
+}
+
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
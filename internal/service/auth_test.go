@@ -0,0 +1,41 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/divanov-web/gophermart/internal/config"
+	"github.com/divanov-web/gophermart/internal/keyring"
+	"github.com/divanov-web/gophermart/internal/mocks"
+	"github.com/divanov-web/gophermart/internal/repository"
+	"github.com/divanov-web/gophermart/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestRefresh_ReuseDropsCachedSession(t *testing.T) {
+	tokenRepo := new(mocks.MockTokenRepo)
+	sessionRepo := new(mocks.MockSessionRepo)
+	cfg := &config.Config{AccessTokenTTL: time.Minute, RefreshTokenTTL: time.Hour, SessionCacheTTL: time.Hour}
+	svc := service.NewAuthService(tokenRepo, sessionRepo, keyring.NewStatic("secret"), zap.NewNop().Sugar(), cfg)
+
+	sessionRepo.On("IsActive", mock.Anything, "session-1", mock.Anything).Return(true, nil).Once()
+	tokenRepo.On("Rotate", mock.Anything, mock.AnythingOfType("string"), mock.Anything, mock.Anything).
+		Return("session-1", repository.ErrRefreshTokenReused)
+
+	active, err := svc.SessionActive(context.Background(), "session-1")
+	require.NoError(t, err)
+	require.True(t, active)
+
+	_, err = svc.Refresh(context.Background(), "stolen-token")
+	require.ErrorIs(t, err, service.ErrRefreshTokenReused)
+
+	// отзыв виден сразу, без похода в БД и без ожидания SessionCacheTTL
+	active, err = svc.SessionActive(context.Background(), "session-1")
+	require.NoError(t, err)
+	assert.False(t, active)
+	sessionRepo.AssertNumberOfCalls(t, "IsActive", 1)
+}
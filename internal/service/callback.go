@@ -0,0 +1,47 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/divanov-web/gophermart/internal/accrual"
+	"github.com/divanov-web/gophermart/internal/model"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrOrderNotFound        = errors.New("order not found")
+	ErrUnknownAccrualStatus = errors.New("unknown accrual status")
+)
+
+// ApplyAccrualCallback применяет статус заказа, который accrual прислал в callback.
+// Переходы те же, что при опросе; заказы не в PROCESSING пропускаются — их доберёт опрос
+func (s *OrderService) ApplyAccrualCallback(ctx context.Context, resp accrual.AccrualResponse) error {
+	if _, err := accrual.ParseAccrualStatus(string(resp.Status)); err != nil {
+		return ErrUnknownAccrualStatus
+	}
+
+	order, err := s.repo.GetByNumber(ctx, resp.Order)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrOrderNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if order.Status != model.OrderStatusProcessing {
+		s.logger.Infow(
+			"Accrual callback for order not in PROCESSING, skipped",
+			"OrderId", order.ID,
+			"status", order.Status,
+			"accrualStatus", resp.Status,
+		)
+		return nil
+	}
+	if !resp.Status.Final() {
+		// промежуточный статус ничего не меняет
+		return nil
+	}
+
+	return s.applyFinalStatus(ctx, order, &resp)
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/divanov-web/gophermart/internal/accrual"
+)
+
+// Экспорт воркерных проходов для тестов пакета service_test
+
+func (s *OrderService) ProcessNewOrders(ctx context.Context, client accrual.AccrualProvider) {
+	s.processNewOrders(ctx, client)
+}
+
+func (s *OrderService) UpdateProcessingOrders(ctx context.Context, client accrual.AccrualProvider, deadline time.Duration) {
+	s.updateProcessingOrders(ctx, client, deadline)
+}
+
+// Экспорт кэша сессий
+
+const SessionCacheMaxEntries = sessionCacheMaxEntries
+
+type SessionCache = sessionCache
+
+func NewSessionCache(ttl time.Duration) *SessionCache {
+	return newSessionCache(ttl)
+}
+
+func (c *sessionCache) Set(id string, active bool, now time.Time) {
+	c.set(id, active, now)
+}
+
+func (c *sessionCache) Get(id string, now time.Time) (active, ok bool) {
+	return c.get(id, now)
+}
+
+func (c *sessionCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/divanov-web/gophermart/internal/model"
+)
+
+const (
+	DefaultHistoryLimit = 50
+	MaxHistoryLimit     = 500
+)
+
+var ErrInvalidCursor = errors.New("invalid history cursor")
+
+// BalanceHistoryItem одна операция по счёту с остатком после неё
+type BalanceHistoryItem struct {
+	Type        model.LedgerEntryKind `json:"type"`
+	Order       string                `json:"order,omitempty"`
+	Amount      model.Money           `json:"amount"`
+	Balance     model.Money           `json:"balance"`
+	ProcessedAt time.Time             `json:"processed_at"`
+}
+
+type BalanceHistoryResponse struct {
+	Items      []BalanceHistoryItem `json:"items"`
+	NextCursor string               `json:"next_cursor,omitempty"`
+}
+
+func encodeCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+func decodeCursor(cursor string) (int64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	id, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil || id < 0 {
+		return 0, ErrInvalidCursor
+	}
+	return id, nil
+}
+
+// GetBalanceHistory история начислений, списаний и корректировок в порядке времени с курсорной пагинацией
+func (s *UserService) GetBalanceHistory(ctx context.Context, userID int64, cursor string, limit int) (*BalanceHistoryResponse, error) {
+	afterID, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = DefaultHistoryLimit
+	}
+	if limit > MaxHistoryLimit {
+		limit = MaxHistoryLimit
+	}
+
+	// берём на одну запись больше, чтобы понять, есть ли следующая страница
+	entries, err := s.repo.GetLedgerByUser(ctx, userID, afterID, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &BalanceHistoryResponse{Items: make([]BalanceHistoryItem, 0, len(entries))}
+	if len(entries) > limit {
+		entries = entries[:limit]
+		resp.NextCursor = encodeCursor(entries[len(entries)-1].ID)
+	}
+	for _, e := range entries {
+		resp.Items = append(resp.Items, BalanceHistoryItem{
+			Type:        e.Kind,
+			Order:       e.OrderNumber,
+			Amount:      e.Amount,
+			Balance:     e.BalanceAfter,
+			ProcessedAt: e.CreatedAt,
+		})
+	}
+	return resp, nil
+}
@@ -0,0 +1,213 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/divanov-web/gophermart/internal/model"
+	"github.com/divanov-web/gophermart/internal/repository"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrIdempotencyInProgress = errors.New("request with this idempotency key is in progress")
+	ErrIdempotencyKeyReused  = errors.New("idempotency key reused with different request")
+	ErrIdempotencyLockLost   = errors.New("idempotency key taken over by another request")
+)
+
+// idempotencyTokenBytes длина случайного токена резерва
+const idempotencyTokenBytes = 16
+
+// MaxIdempotencyKeyLength ограничение длины заголовка Idempotency-Key
+const MaxIdempotencyKeyLength = 255
+
+type IdempotencyService struct {
+	repo        repository.IdempotencyRepository
+	ttl         time.Duration
+	lockTimeout time.Duration
+	logger      *zap.SugaredLogger
+}
+
+// IdempotencyReservation ключ, занятый текущим запросом. Token отличает этот резерв от резерва повтора,
+// забравшего ключ после lockTimeout: ответ сохраняет только владелец актуального резерва
+type IdempotencyReservation struct {
+	UserID int64
+	Key    string
+	Token  string
+}
+
+// NewIdempotencyService ttl — срок хранения ответа, lockTimeout — сколько запрос держит ключ без продления.
+// Пока запрос выполняется, KeepLocked продлевает резерв, поэтому забрать ключ можно только у брошенного запроса
+func NewIdempotencyService(repo repository.IdempotencyRepository, ttl, lockTimeout time.Duration, logger *zap.SugaredLogger) *IdempotencyService {
+	return &IdempotencyService{
+		repo:        repo,
+		ttl:         ttl,
+		lockTimeout: lockTimeout,
+		logger:      logger,
+	}
+}
+
+// Fingerprint хэш тела запроса
+func Fingerprint(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// Begin занимает ключ для нового запроса. Если по ключу уже есть готовый ответ — возвращает его для повтора.
+// Иначе возвращает резерв: на время обработки его держит KeepLocked, после — Complete или Release
+func (s *IdempotencyService) Begin(ctx context.Context, userID int64, key, fingerprint string) (*model.IdempotencyRecord, *IdempotencyReservation, error) {
+	token, err := randomToken(idempotencyTokenBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	record := &model.IdempotencyRecord{
+		UserID:      userID,
+		Key:         key,
+		Fingerprint: fingerprint,
+		ExpiresAt:   now.Add(s.ttl),
+		LockedUntil: now.Add(s.lockTimeout),
+		Token:       token,
+	}
+	reservation := &IdempotencyReservation{UserID: userID, Key: key, Token: token}
+
+	reserved, err := s.repo.Reserve(ctx, record)
+	if err != nil {
+		return nil, nil, err
+	}
+	if reserved {
+		return nil, reservation, nil
+	}
+
+	existing, err := s.repo.Get(ctx, userID, key)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// ключ успели удалить между попытками — пробуем ещё раз
+		return s.retryReserve(ctx, record, reservation)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if existing.ExpiresAt.Before(now) {
+		if err := s.repo.Delete(ctx, userID, key); err != nil {
+			return nil, nil, err
+		}
+		return s.retryReserve(ctx, record, reservation)
+	}
+	if existing.Fingerprint != fingerprint {
+		return nil, nil, ErrIdempotencyKeyReused
+	}
+	if existing.StatusCode == 0 {
+		if !existing.LockedUntil.Before(now) {
+			return nil, nil, ErrIdempotencyInProgress
+		}
+		// запрос не завершился и перестал продлевать резерв — повтор выполняется заново
+		reclaimed, err := s.repo.Reclaim(ctx, record, now)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !reclaimed {
+			return nil, nil, ErrIdempotencyInProgress
+		}
+		s.logger.Warnw("Abandoned idempotency key reclaimed", "userID", userID, "key", key)
+		return nil, reservation, nil
+	}
+	return existing, nil, nil
+}
+
+func (s *IdempotencyService) retryReserve(ctx context.Context, record *model.IdempotencyRecord, reservation *IdempotencyReservation) (*model.IdempotencyRecord, *IdempotencyReservation, error) {
+	reserved, err := s.repo.Reserve(ctx, record)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !reserved {
+		return nil, nil, ErrIdempotencyInProgress
+	}
+	return nil, reservation, nil
+}
+
+// KeepLocked продлевает резерв каждые lockTimeout/3, пока запрос выполняется. stop останавливает продление
+func (s *IdempotencyService) KeepLocked(ctx context.Context, reservation *IdempotencyReservation) (stop func()) {
+	// продлеваем и после отключения клиента: обработчик продолжает работу
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	done := make(chan struct{})
+	ticker := time.NewTicker(s.lockTimeout / 3)
+
+	go func() {
+		defer close(done)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				err := s.repo.Extend(ctx, reservation.UserID, reservation.Key, reservation.Token, time.Now().Add(s.lockTimeout))
+				if errors.Is(err, repository.ErrIdempotencyLockLost) {
+					s.logger.Warnw("Idempotency key taken over while request is running", "userID", reservation.UserID, "key", reservation.Key)
+					return
+				}
+				if err != nil {
+					s.logger.Errorw("failed to extend idempotency key", "error", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// Complete сохраняет ответ, который будет отдаваться на повторы с тем же ключом.
+// ErrIdempotencyLockLost — ключ забрал другой запрос, ответ не сохранён
+func (s *IdempotencyService) Complete(ctx context.Context, reservation *IdempotencyReservation, statusCode int, contentType string, body []byte) error {
+	err := s.repo.Complete(ctx, reservation.UserID, reservation.Key, reservation.Token, statusCode, contentType, body)
+	if errors.Is(err, repository.ErrIdempotencyLockLost) {
+		return ErrIdempotencyLockLost
+	}
+	return err
+}
+
+// Release освобождает ключ, если запрос завершился ошибкой сервера и клиент может повторить его.
+// Резерв, который уже забрал другой запрос, не трогается
+func (s *IdempotencyService) Release(ctx context.Context, reservation *IdempotencyReservation) error {
+	err := s.repo.Release(ctx, reservation.UserID, reservation.Key, reservation.Token)
+	if errors.Is(err, repository.ErrIdempotencyLockLost) {
+		return ErrIdempotencyLockLost
+	}
+	return err
+}
+
+// StartCleanupWorker Создаёт горутину, периодически удаляет просроченные ключи
+func (s *IdempotencyService) StartCleanupWorker(ctx context.Context, wg *sync.WaitGroup, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				deleted, err := s.repo.DeleteExpired(ctx, time.Now())
+				if err != nil {
+					s.logger.Errorw("failed to delete expired idempotency keys", "error", err)
+					continue
+				}
+				if deleted > 0 {
+					s.logger.Infow("Expired idempotency keys deleted", "count", deleted)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
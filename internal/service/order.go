@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/divanov-web/gophermart/internal/accrual"
 	"github.com/divanov-web/gophermart/internal/config"
 	"github.com/divanov-web/gophermart/internal/model"
@@ -10,6 +11,8 @@ import (
 	"github.com/divanov-web/gophermart/internal/utils"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+	"os"
+	"sync"
 	"time"
 )
 
@@ -20,6 +23,8 @@ var (
 	ErrInvalidWithdrawOrder = errors.New("invalid order number format")
 	ErrInsufficientFunds    = errors.New("not enough funds")
 	ErrNegativeWithdraw     = errors.New("withdraw sum must be positive")
+	ErrWithdrawOrderUsed    = errors.New("order already paid with points")
+	ErrOrderNotStuck        = errors.New("order is not stuck")
 )
 
 type OrderService struct {
@@ -27,11 +32,13 @@ type OrderService struct {
 	userRepo repository.UserRepository
 	logger   *zap.SugaredLogger
 	config   *config.Config
+	pause    *accrual.Pause // общая пауза воркеров после 429 от accrual
+	owner    string         // идентификатор реплики в аренде заказов
 }
 
 type WithdrawalRequest struct {
-	Order string  `json:"order"`
-	Sum   float64 `json:"sum"`
+	Order string      `json:"order"`
+	Sum   model.Money `json:"sum"`
 }
 
 func NewOrderService(repo repository.OrderRepository, userRepo repository.UserRepository, logger *zap.SugaredLogger, config *config.Config) *OrderService {
@@ -40,6 +47,8 @@ func NewOrderService(repo repository.OrderRepository, userRepo repository.UserRe
 		userRepo: userRepo,
 		logger:   logger,
 		config:   config,
+		pause:    accrual.NewPause(),
+		owner:    instanceID(),
 	}
 }
 
@@ -70,14 +79,25 @@ func (s *OrderService) UploadOrder(ctx context.Context, userID int64, number str
 	return s.repo.Create(ctx, newOrder)
 }
 
-func (s *OrderService) GetOrdersByUser(ctx context.Context, userID int64) ([]model.Order, error) {
-	return s.repo.GetByUserID(ctx, userID)
+// GetOrdersByUser заказы пользователя для GET /api/user/orders, новые первыми
+func (s *OrderService) GetOrdersByUser(ctx context.Context, userID int64) ([]OrderResponse, error) {
+	orders, err := s.repo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	resp := make([]OrderResponse, 0, len(orders))
+	for _, o := range orders {
+		resp = append(resp, newOrderResponse(o))
+	}
+	return resp, nil
 }
 
 // StartOrderSenderWorker Создаёт горутину, отправляет заказы в Accrual (только для локального сервера)
-func (s *OrderService) StartOrderSenderWorker(ctx context.Context, interval time.Duration, client *accrual.Client) {
+func (s *OrderService) StartOrderSenderWorker(ctx context.Context, wg *sync.WaitGroup, interval time.Duration, client accrual.AccrualProvider) {
 	ticker := time.NewTicker(interval)
+	wg.Add(1)
 	go func() {
+		defer wg.Done()
 		defer ticker.Stop()
 
 		for {
@@ -92,39 +112,71 @@ func (s *OrderService) StartOrderSenderWorker(ctx context.Context, interval time
 }
 
 // processNewOrders Отправляет заказы в Accrual и меняет статус с NEW на PROCESSING
-func (s *OrderService) processNewOrders(ctx context.Context, client *accrual.Client) {
-	orders, err := s.repo.GetByStatus(ctx, model.OrderStatusNew)
+func (s *OrderService) processNewOrders(ctx context.Context, client accrual.AccrualProvider) {
+	if !s.accrualReady(client) {
+		return
+	}
+
+	orders, err := s.claimOrders(ctx, model.OrderStatusNew)
 	if err != nil {
-		// todo лог ошибки
+		s.logger.Errorw("failed to load new orders", "error", err)
 		return
 	}
+	if len(orders) == 0 {
+		return
+	}
+
+	// проход укладывается в аренду: после неё заказы может захватить и отправить другая реплика
+	passCtx, cancel := context.WithTimeout(ctx, s.config.OrderClaimLease)
+	defer cancel()
 
 	for _, order := range orders {
+		// при остановке сервиса или истечении аренды не начинаем обработку следующего заказа
+		if passCtx.Err() != nil {
+			return
+		}
 		if s.config.SendOrders {
-			err := client.SendOrder(order.Number)
+			err := client.SendOrder(passCtx, order.Number)
+			if s.handleRateLimit(err) || errors.Is(err, accrual.ErrCircuitOpen) {
+				return
+			}
+			if passCtx.Err() != nil {
+				// неудача из-за дедлайна прохода — не попытка заказа, он вернётся в работу после аренды
+				return
+			}
 			if err != nil {
 				s.logger.Errorw("failed to send order to accrual", "error", err)
+				s.retryLater(passCtx, &order, err.Error())
 				continue
 			}
 		}
 
-		// Обновляем статус заказа на PROCESSING
-		order.Status = model.OrderStatusProcessing
-		_ = s.repo.Update(ctx, &order)
+		// Обновляем статус заказа на PROCESSING, неудачные попытки отправки больше не учитываются
+		if err := s.repo.MarkSent(passCtx, &order); err != nil {
+			s.logger.Errorw("failed to move order to PROCESSING", "OrderId", order.ID, "error", err)
+		}
 	}
 }
 
 // StartAccrualUpdaterWorker Создаёт горутину, периодически проверяет статус заказа в Accrual
-func (s *OrderService) StartAccrualUpdaterWorker(ctx context.Context, interval time.Duration, client *accrual.Client) {
+func (s *OrderService) StartAccrualUpdaterWorker(ctx context.Context, wg *sync.WaitGroup, interval time.Duration, client accrual.AccrualProvider) {
 	ticker := time.NewTicker(interval)
 
+	// дедлайн одного прохода; по умолчанию проход должен уложиться в интервал тикера
+	deadline := s.config.AccrualPollTimeout
+	if deadline <= 0 {
+		deadline = interval
+	}
+
+	wg.Add(1)
 	go func() {
+		defer wg.Done()
 		defer ticker.Stop()
 
 		for {
 			select {
 			case <-ticker.C:
-				s.updateProcessingOrders(ctx, client)
+				s.updateProcessingOrders(ctx, client, deadline)
 			case <-ctx.Done():
 				return
 			}
@@ -132,59 +184,227 @@ func (s *OrderService) StartAccrualUpdaterWorker(ctx context.Context, interval t
 	}()
 }
 
-// updateProcessingOrders Проверяет заказы в Accrual и меняет статус с PROCESSING на INVALID или PROCESSED
-func (s *OrderService) updateProcessingOrders(ctx context.Context, client *accrual.Client) {
-	orders, err := s.repo.GetByStatus(ctx, model.OrderStatusProcessing)
+// updateProcessingOrders Проверяет заказы в Accrual и меняет статус с PROCESSING на INVALID или PROCESSED.
+// Заказы раздаются пулу из config.AccrualWorkers воркеров через канал ограниченного размера,
+// поэтому при медленном accrual чтение новых заданий притормаживает (backpressure)
+func (s *OrderService) updateProcessingOrders(ctx context.Context, client accrual.AccrualProvider, deadline time.Duration) {
+	if !s.accrualReady(client) {
+		return
+	}
+
+	orders, err := s.claimOrders(ctx, model.OrderStatusProcessing)
 	if err != nil {
-		// TODO: лог ошибки
+		s.logger.Errorw("failed to load processing orders", "error", err)
+		return
+	}
+	if len(orders) == 0 {
 		return
 	}
 
-	for _, order := range orders {
-		resp, err := client.GetOrderInfo(order.Number)
-		if err != nil || resp == nil {
-			// TODO: лог ошибки или пропуск необработанного заказа
-			continue
-		}
+	passCtx, cancel := context.WithTimeout(ctx, deadline)
+	defer cancel()
 
-		switch resp.Status {
-		case "REGISTERED", "PROCESSING":
-			// оставим без изменений
-			continue
-		case "PROCESSED":
-			order.Status = model.OrderStatusProcessed
-			order.Accrual = resp.Accrual
-			if err := s.repo.Update(ctx, &order); err != nil {
-				// лог ошибки
-				continue
-			}
-			if resp.Accrual != nil {
-				err := s.userRepo.IncreaseBalance(ctx, order.UserID, *resp.Accrual)
-				if err == nil {
-					s.logger.Infow(
-						"User balance increased",
-						"userID", order.UserID,
-						"sum", *resp.Accrual,
-					)
-				} else {
-					s.logger.Errorw(
-						"Failed to increase user balance",
-						"error", err,
-					)
+	workers := s.config.AccrualWorkers
+	if workers <= 0 {
+		workers = 1
+	}
+	if workers > len(orders) {
+		workers = len(orders)
+	}
+
+	jobs := make(chan model.Order, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for order := range jobs {
+				// после 429, размыкания автомата или дедлайна дочитываем канал, не обращаясь к accrual
+				if passCtx.Err() != nil || !s.accrualReady(client) {
+					continue
 				}
+				s.updateOrder(passCtx, client, order)
 			}
-		case "INVALID":
-			order.Status = model.OrderStatusInvalid
-			_ = s.repo.Update(ctx, &order)
+		}()
+	}
+
+feed:
+	for _, order := range orders {
+		if !s.accrualReady(client) {
+			break
+		}
+		select {
+		case jobs <- order:
+		case <-passCtx.Done():
+			s.logger.Warnw(
+				"Accrual poll pass deadline exceeded",
+				"deadline", deadline,
+				"orders", len(orders),
+			)
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// updateOrder Запрашивает статус одного заказа в Accrual и применяет его
+func (s *OrderService) updateOrder(ctx context.Context, client accrual.AccrualProvider, order model.Order) {
+	resp, err := client.GetOrderInfo(ctx, order.Number)
+	switch {
+	case s.handleRateLimit(err):
+		countPoll(pollRateLimited)
+		return
+	case errors.Is(err, accrual.ErrCircuitOpen):
+		countPoll(pollCircuitOpen)
+		return
+	case errors.Is(err, accrual.ErrUnknownStatus):
+		// статус вне протокола записываем на заказ, после исчерпания попыток он станет STUCK
+		countPoll(pollUnknownStatus)
+		s.logger.Warnw("Unknown accrual status", "OrderId", order.ID, "error", err)
+		s.retryLater(ctx, &order, err.Error())
+		return
+	case err != nil:
+		// остановка сервиса или дедлайн прохода — не вина заказа
+		if ctx.Err() != nil {
+			return
+		}
+		countPoll(pollError)
+		s.retryLater(ctx, &order, err.Error())
+		return
+	case resp == nil:
+		countPoll(pollNotRegistered)
+		s.resendOrder(ctx, client, &order)
+		return
+	}
+
+	switch resp.Status {
+	case accrual.StatusRegistered, accrual.StatusProcessing:
+		countPoll(string(resp.Status))
+		s.logger.Debugw("Order is still being calculated", "OrderId", order.ID, "accrualStatus", resp.Status)
+		// статус не меняем, снимаем аренду, чтобы заказ проверился в следующем проходе
+		if err := s.repo.ReleaseClaim(ctx, &order); err != nil {
+			s.logger.Errorw("Failed to release order claim", "OrderId", order.ID, "error", err)
+		}
+	case accrual.StatusProcessed, accrual.StatusInvalid:
+		countPoll(string(resp.Status))
+		_ = s.applyFinalStatus(ctx, &order, resp)
+	default:
+		countPoll(pollUnknownStatus)
+		// провайдер вернул ответ в обход строгого разбора — заказ не должен опрашиваться вечно
+		s.logger.Warnw("Unknown accrual status", "OrderId", order.ID, "accrualStatus", resp.Status)
+		s.retryLater(ctx, &order, fmt.Sprintf("unknown accrual status %q", resp.Status))
+	}
+}
+
+// resendOrder повторно отправляет в accrual заказ, о котором тот не знает (ответ 204).
+// Проверка всё равно откладывается с учётом попытки: если заказ так и не появится, он станет STUCK
+func (s *OrderService) resendOrder(ctx context.Context, client accrual.AccrualProvider, order *model.Order) {
+	if !s.config.SendOrders {
+		s.logger.Warnw("Order is not registered in accrual", "OrderId", order.ID)
+		s.retryLater(ctx, order, "order is not registered in accrual")
+		return
+	}
+
+	err := client.SendOrder(ctx, order.Number)
+	if s.handleRateLimit(err) || errors.Is(err, accrual.ErrCircuitOpen) {
+		return
+	}
+	if err != nil {
+		s.logger.Errorw("Failed to resend order to accrual", "OrderId", order.ID, "error", err)
+		s.retryLater(ctx, order, "resend failed: "+err.Error())
+		return
+	}
+	countPoll(pollResent)
+	s.logger.Infow("Order was not registered in accrual, resent", "OrderId", order.ID)
+	s.retryLater(ctx, order, "order was not registered in accrual, resent")
+}
+
+// applyFinalStatus применяет окончательный статус PROCESSED или INVALID из accrual.
+// Используется и опросом, и callback-ом, поэтому повторное применение безопасно
+func (s *OrderService) applyFinalStatus(ctx context.Context, order *model.Order, resp *accrual.AccrualResponse) error {
+	switch resp.Status {
+	case accrual.StatusProcessed:
+		// смена статуса и начисление баллов — одна транзакция, баллы начисляются ровно один раз
+		err := s.repo.MarkProcessed(ctx, order, resp.Accrual)
+		switch {
+		case errors.Is(err, repository.ErrOrderNotProcessing):
 			s.logger.Infow(
-				"Order status invalid in accrual",
+				"Order already processed, skip accrual",
 				"OrderId", order.ID,
 			)
+		case err != nil:
+			s.logger.Errorw(
+				"Failed to mark order processed",
+				"OrderId", order.ID,
+				"error", err,
+			)
+			return err
+		case resp.Accrual != nil:
+			s.logger.Infow(
+				"User balance increased",
+				"userID", order.UserID,
+				"sum", *resp.Accrual,
+			)
+		}
+	case accrual.StatusInvalid:
+		err := s.repo.MarkInvalid(ctx, order)
+		switch {
+		case errors.Is(err, repository.ErrOrderNotProcessing):
+			s.logger.Infow("Order already finalized, skip invalid status", "OrderId", order.ID)
+		case err != nil:
+			s.logger.Errorw("Failed to mark order invalid", "OrderId", order.ID, "error", err)
+			return err
 		default:
-			// TODO: лог неизвестного статуса
-			continue
+			s.logger.Infow(
+				"Order status invalid in accrual",
+				"OrderId", order.ID,
+			)
 		}
 	}
+	return nil
+}
+
+// claimOrders захватывает пачку заказов в статусе status для этой реплики.
+// Заказы, до которых проход не дошёл (429, дедлайн, остановка), вернутся в работу по истечении аренды
+func (s *OrderService) claimOrders(ctx context.Context, status model.OrderStatus) ([]model.Order, error) {
+	return s.repo.ClaimDue(ctx, status, s.owner, s.config.OrderClaimBatch, s.config.OrderClaimLease)
+}
+
+// instanceID имя реплики для аренды заказов: хост и pid процесса
+func instanceID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// accrualReady false, если accrual попросил подождать или автомат защиты разомкнут
+func (s *OrderService) accrualReady(client accrual.AccrualProvider) bool {
+	if s.pause.Remaining() > 0 {
+		return false
+	}
+	if a, ok := client.(accrual.Availability); ok && !a.Available() {
+		return false
+	}
+	return true
+}
+
+// handleRateLimit ставит общую паузу воркеров, если err — ответ 429 от accrual
+func (s *OrderService) handleRateLimit(err error) bool {
+	var rateErr *accrual.RateLimitError
+	if !errors.As(err, &rateErr) {
+		return false
+	}
+
+	until := s.pause.Set(rateErr.RetryAfter)
+	s.logger.Warnw(
+		"Accrual rate limit exceeded, workers paused",
+		"retryAfter", rateErr.RetryAfter,
+		"until", until,
+	)
+	return true
 }
 
 func (s *OrderService) Withdraw(ctx context.Context, userID int64, req WithdrawalRequest) error {
@@ -200,6 +420,9 @@ func (s *OrderService) Withdraw(ctx context.Context, userID int64, req Withdrawa
 	if errors.Is(err, repository.ErrLowBalance) {
 		return ErrInsufficientFunds
 	}
+	if errors.Is(err, repository.ErrWithdrawalExists) {
+		return ErrWithdrawOrderUsed
+	}
 
 	return err
 }
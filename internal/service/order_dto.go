@@ -0,0 +1,58 @@
+package service
+
+import (
+	"time"
+
+	"github.com/divanov-web/gophermart/internal/model"
+)
+
+// OrderResponse заказ в ответе GET /api/user/orders. Время отдаётся в RFC3339 с точностью до секунды
+type OrderResponse struct {
+	Number       string            `json:"number"`
+	Status       model.OrderStatus `json:"status"`
+	StatusReason string            `json:"status_reason"`
+	Accrual      *model.Money      `json:"accrual,omitempty"`
+	UploadedAt   time.Time         `json:"uploaded_at"`
+	ProcessedAt  *time.Time        `json:"processed_at,omitempty"`
+}
+
+func newOrderResponse(o model.Order) OrderResponse {
+	resp := OrderResponse{
+		Number:       o.Number,
+		Status:       o.Status,
+		StatusReason: statusReason(o),
+		Accrual:      o.Accrual,
+		UploadedAt:   o.CreatedAt.Truncate(time.Second),
+	}
+	// STUCK — внутренний статус, для пользователя заказ всё ещё обрабатывается
+	if o.Status == model.OrderStatusStuck {
+		resp.Status = model.OrderStatusProcessing
+	}
+	if o.ProcessedAt != nil {
+		processedAt := o.ProcessedAt.Truncate(time.Second)
+		resp.ProcessedAt = &processedAt
+	}
+	return resp
+}
+
+// statusReason пояснение статуса заказа для пользователя
+func statusReason(o model.Order) string {
+	switch o.Status {
+	case model.OrderStatusNew:
+		return "order is uploaded and waiting to be sent for accrual calculation"
+	case model.OrderStatusProcessing:
+		return "accrual is being calculated"
+	case model.OrderStatusStuck:
+		// автоматически STUCK-заказ не проверяется, его возвращает в работу оператор (orders requeue)
+		return "accrual calculation is delayed and awaits manual review by support"
+	case model.OrderStatusInvalid:
+		return "order was rejected by the accrual system, no points will be credited"
+	case model.OrderStatusProcessed:
+		if o.Accrual == nil || *o.Accrual == 0 {
+			return "accrual calculated, no points for this order"
+		}
+		return "accrual calculated and credited to the balance"
+	default:
+		return ""
+	}
+}
@@ -2,10 +2,13 @@ package service_test
 
 import (
 	"context"
+	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/divanov-web/gophermart/internal/mocks"
 	"github.com/divanov-web/gophermart/internal/model"
+	"github.com/divanov-web/gophermart/internal/repository"
 	"github.com/divanov-web/gophermart/internal/service"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -73,3 +76,54 @@ func TestUploadOrder_InvalidNumber(t *testing.T) {
 	err := svc.UploadOrder(ctx, userID, orderNumber)
 	assert.ErrorIs(t, err, service.ErrInvalidOrderNumber)
 }
+
+func TestWithdraw_OrderAlreadyPaid(t *testing.T) {
+	orderRepo := new(mocks.MockOrderRepo)
+	userRepo := new(mocks.MockUserRepo)
+	svc := service.NewOrderService(orderRepo, userRepo, nil, nil)
+
+	ctx := context.Background()
+	req := service.WithdrawalRequest{Order: "2377225624", Sum: model.Money(75100)}
+
+	userRepo.On("WithdrawBalance", ctx, int64(1), req.Sum, req.Order).Return(repository.ErrWithdrawalExists)
+
+	err := svc.Withdraw(ctx, 1, req)
+	assert.ErrorIs(t, err, service.ErrWithdrawOrderUsed)
+}
+
+func TestGetOrdersByUser_Response(t *testing.T) {
+	orderRepo := new(mocks.MockOrderRepo)
+	svc := service.NewOrderService(orderRepo, new(mocks.MockUserRepo), nil, nil)
+
+	ctx := context.Background()
+	uploaded := time.Date(2020, 12, 10, 15, 15, 45, 123456789, time.FixedZone("MSK", 3*60*60))
+	processed := uploaded.Add(time.Minute)
+	accrual := model.Money(50000)
+
+	orderRepo.On("GetByUserID", ctx, int64(1)).Return([]model.Order{
+		{Number: "9278923470", Status: model.OrderStatusProcessed, Accrual: &accrual, CreatedAt: uploaded, ProcessedAt: &processed},
+		{Number: "12345678903", Status: model.OrderStatusStuck, CreatedAt: uploaded},
+	}, nil)
+
+	orders, err := svc.GetOrdersByUser(ctx, 1)
+	assert.NoError(t, err)
+
+	data, err := json.Marshal(orders)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[
+		{
+			"number": "9278923470",
+			"status": "PROCESSED",
+			"status_reason": "accrual calculated and credited to the balance",
+			"accrual": 500,
+			"uploaded_at": "2020-12-10T15:15:45+03:00",
+			"processed_at": "2020-12-10T15:16:45+03:00"
+		},
+		{
+			"number": "12345678903",
+			"status": "PROCESSING",
+			"status_reason": "accrual calculation is delayed and awaits manual review by support",
+			"uploaded_at": "2020-12-10T15:15:45+03:00"
+		}
+	]`, string(data))
+}
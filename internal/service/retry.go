@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/divanov-web/gophermart/internal/model"
+	"github.com/divanov-web/gophermart/internal/repository"
+)
+
+// retryDelay экспоненциальная задержка перед attempts-й повторной проверкой: base, 2*base, 4*base... не больше max
+func retryDelay(attempts int, base, max time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= max {
+			return max
+		}
+	}
+	if delay > max {
+		return max
+	}
+	return delay
+}
+
+// retryLater учитывает неудачную попытку по заказу: откладывает следующую проверку
+// или переводит заказ в STUCK, если попытки или время жизни заказа исчерпаны
+func (s *OrderService) retryLater(ctx context.Context, order *model.Order, reason string) {
+	attempts := order.Attempts + 1
+	tooOld := !order.CreatedAt.IsZero() && time.Since(order.CreatedAt) > s.config.OrderMaxAge
+	if attempts >= s.config.OrderMaxAttempts || tooOld {
+		if err := s.repo.MarkStuck(ctx, order, reason); err != nil {
+			s.logger.Errorw("Failed to mark order stuck", "OrderId", order.ID, "error", err)
+			return
+		}
+		s.logger.Warnw(
+			"Order is stuck, manual requeue required",
+			"OrderId", order.ID,
+			"number", order.Number,
+			"attempts", attempts,
+			"lastError", reason,
+		)
+		return
+	}
+
+	next := time.Now().Add(retryDelay(attempts, s.config.OrderRetryBase, s.config.OrderRetryMax))
+	if err := s.repo.ScheduleRetry(ctx, order, reason, next); err != nil {
+		s.logger.Errorw("Failed to schedule order retry", "OrderId", order.ID, "error", err)
+		return
+	}
+	s.logger.Infow(
+		"Order check failed, retry scheduled",
+		"OrderId", order.ID,
+		"attempts", attempts,
+		"nextCheckAt", next,
+		"lastError", reason,
+	)
+}
+
+// ListStuckOrders заказы, по которым accrual так и не дал ответа
+func (s *OrderService) ListStuckOrders(ctx context.Context) ([]model.Order, error) {
+	return s.repo.GetByStatus(ctx, model.OrderStatusStuck)
+}
+
+// RequeueOrder возвращает зависший заказ в обработку со сброшенным счётчиком попыток
+func (s *OrderService) RequeueOrder(ctx context.Context, number string) error {
+	err := s.repo.Requeue(ctx, number)
+	if errors.Is(err, repository.ErrOrderNotStuck) {
+		return ErrOrderNotStuck
+	}
+	return err
+}
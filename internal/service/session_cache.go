@@ -0,0 +1,86 @@
+package service
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// sessionCacheMaxEntries предельный размер кэша: при записи в полный кэш сначала вычищаются устаревшие
+// записи, а если их не хватило — самые старые, пока не освободится десятая часть
+const sessionCacheMaxEntries = 10000
+
+// sessionCache кэш проверки отзыва сессий в памяти процесса, чтобы не ходить в БД на каждый запрос.
+// Отзыв на этой реплике виден сразу, на остальных — не позже чем через ttl
+type sessionCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]sessionCacheEntry
+}
+
+type sessionCacheEntry struct {
+	active    bool
+	expiresAt time.Time
+}
+
+func newSessionCache(ttl time.Duration) *sessionCache {
+	return &sessionCache{
+		ttl:     ttl,
+		entries: make(map[string]sessionCacheEntry),
+	}
+}
+
+// get результат проверки сессии из кэша; ok == false — в кэше нет свежей записи
+func (c *sessionCache) get(id string, now time.Time) (active, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, found := c.entries[id]
+	if !found {
+		return false, false
+	}
+	if !now.Before(e.expiresAt) {
+		delete(c.entries, id)
+		return false, false
+	}
+	return e.active, true
+}
+
+func (c *sessionCache) set(id string, active bool, now time.Time) {
+	if c.ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, found := c.entries[id]; !found && len(c.entries) >= sessionCacheMaxEntries {
+		c.evict(now)
+	}
+	c.entries[id] = sessionCacheEntry{active: active, expiresAt: now.Add(c.ttl)}
+}
+
+// evict освобождает место в кэше. Вытеснение только заставляет сходить в БД за свежим результатом
+func (c *sessionCache) evict(now time.Time) {
+	for k, e := range c.entries {
+		if !now.Before(e.expiresAt) {
+			delete(c.entries, k)
+		}
+	}
+
+	limit := sessionCacheMaxEntries - sessionCacheMaxEntries/10
+	if len(c.entries) <= limit {
+		return
+	}
+	ids := make([]string, 0, len(c.entries))
+	for k := range c.entries {
+		ids = append(ids, k)
+	}
+	// все записи живут одинаковый ttl, поэтому раньше истекают самые старые
+	slices.SortFunc(ids, func(a, b string) int {
+		return c.entries[a].expiresAt.Compare(c.entries[b].expiresAt)
+	})
+	for _, k := range ids[:len(ids)-limit] {
+		delete(c.entries, k)
+	}
+}
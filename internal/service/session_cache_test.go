@@ -0,0 +1,28 @@
+package service_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/divanov-web/gophermart/internal/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionCache_EvictsOldestWhenFull(t *testing.T) {
+	cache := service.NewSessionCache(time.Hour)
+	start := time.Now()
+
+	// все записи свежие: вычищать по сроку нечего
+	for i := 0; i < service.SessionCacheMaxEntries+500; i++ {
+		cache.Set(fmt.Sprintf("s-%d", i), true, start.Add(time.Duration(i)*time.Millisecond))
+	}
+
+	assert.LessOrEqual(t, cache.Len(), service.SessionCacheMaxEntries)
+	now := start.Add(time.Duration(service.SessionCacheMaxEntries+500) * time.Millisecond)
+	_, ok := cache.Get("s-0", now)
+	assert.False(t, ok, "oldest entry must be evicted")
+	active, ok := cache.Get(fmt.Sprintf("s-%d", service.SessionCacheMaxEntries+499), now)
+	assert.True(t, ok)
+	assert.True(t, active)
+}
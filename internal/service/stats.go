@@ -0,0 +1,23 @@
+package service
+
+import (
+	"expvar"
+	"strings"
+)
+
+// pollStats счётчики исходов опроса accrual в expvar-переменной accrual_poll.
+// Кроме перечисленных ниже ключей, считаются и сами статусы accrual (registered, processed, ...)
+var pollStats = expvar.NewMap("accrual_poll")
+
+const (
+	pollNotRegistered = "not_registered" // ответ 204
+	pollResent        = "resent"         // заказ повторно отправлен после 204
+	pollUnknownStatus = "unknown_status"
+	pollError         = "error"
+	pollRateLimited   = "rate_limited"
+	pollCircuitOpen   = "circuit_open"
+)
+
+func countPoll(outcome string) {
+	pollStats.Add(strings.ToLower(outcome), 1)
+}
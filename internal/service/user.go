@@ -14,8 +14,8 @@ type UserService struct {
 }
 
 type BalanceResponse struct {
-	Current   float64 `json:"current"`
-	Withdrawn float64 `json:"withdrawn"`
+	Current   model.Money `json:"current"`
+	Withdrawn model.Money `json:"withdrawn"`
 }
 
 var ErrLoginTaken = errors.New("login already in use")
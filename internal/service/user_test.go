@@ -86,11 +86,42 @@ func TestGetUserBalance(t *testing.T) {
 	ctx := context.Background()
 	userID := int64(42)
 
-	repo.On("GetBalance", ctx, userID).Return(100.5, 40.0, nil)
+	repo.On("GetBalance", ctx, userID).Return(model.Money(10050), model.Money(4000), nil)
 
 	resp, err := svc.GetUserBalance(ctx, userID)
 
 	assert.NoError(t, err)
-	assert.Equal(t, 100.5, resp.Current)
-	assert.Equal(t, 40.0, resp.Withdrawn)
+	assert.Equal(t, model.Money(10050), resp.Current)
+	assert.Equal(t, model.Money(4000), resp.Withdrawn)
+}
+
+func TestGetBalanceHistory_Pagination(t *testing.T) {
+	repo := new(mocks.MockUserRepo)
+	svc := service.NewUserService(repo)
+
+	ctx := context.Background()
+	userID := int64(42)
+
+	entries := []model.LedgerEntry{
+		{ID: 3, Kind: model.LedgerKindAccrual, OrderNumber: "79927398713", Amount: 50000, BalanceAfter: 50000},
+		{ID: 7, Kind: model.LedgerKindWithdrawal, OrderNumber: "2377225624", Amount: -10050, BalanceAfter: 39950},
+		{ID: 9, Kind: model.LedgerKindAdjustment, Amount: 50, BalanceAfter: 40000},
+	}
+	repo.On("GetLedgerByUser", ctx, userID, int64(0), 3).Return(entries, nil)
+	repo.On("GetLedgerByUser", ctx, userID, int64(7), 3).Return(entries[2:], nil)
+
+	first, err := svc.GetBalanceHistory(ctx, userID, "", 2)
+	assert.NoError(t, err)
+	assert.Len(t, first.Items, 2)
+	assert.Equal(t, model.Money(39950), first.Items[1].Balance)
+	assert.NotEmpty(t, first.NextCursor)
+
+	second, err := svc.GetBalanceHistory(ctx, userID, first.NextCursor, 2)
+	assert.NoError(t, err)
+	assert.Len(t, second.Items, 1)
+	assert.Equal(t, model.LedgerKindAdjustment, second.Items[0].Type)
+	assert.Empty(t, second.NextCursor)
+
+	_, err = svc.GetBalanceHistory(ctx, userID, "not a cursor!", 2)
+	assert.ErrorIs(t, err, service.ErrInvalidCursor)
 }
@@ -0,0 +1,367 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/divanov-web/gophermart/internal/accrual"
+	"github.com/divanov-web/gophermart/internal/config"
+	"github.com/divanov-web/gophermart/internal/mocks"
+	"github.com/divanov-web/gophermart/internal/model"
+	"github.com/divanov-web/gophermart/internal/repository"
+	"github.com/divanov-web/gophermart/internal/service"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap"
+)
+
+const workerOrderNumber = "79927398713"
+
+func moneyPtr(v model.Money) *model.Money {
+	return &v
+}
+
+// testOrderConfig параметры повторов и захвата заказов как у NewConfig по умолчанию
+func testOrderConfig(workers int) *config.Config {
+	return &config.Config{
+		AccrualWorkers:   workers,
+		OrderRetryBase:   5 * time.Second,
+		OrderRetryMax:    time.Hour,
+		OrderMaxAttempts: 20,
+		OrderMaxAge:      72 * time.Hour,
+		OrderClaimBatch:  100,
+		OrderClaimLease:  time.Minute,
+	}
+}
+
+func TestUpdateProcessingOrders(t *testing.T) {
+	processingOrder := model.Order{ID: 1, Number: workerOrderNumber, UserID: 42, Status: model.OrderStatusProcessing, CreatedAt: time.Now()}
+	claimReleased := func(repo *mocks.MockOrderRepo) {
+		repo.On("ReleaseClaim", mock.Anything, mock.AnythingOfType("*model.Order")).Return(nil)
+	}
+	retryScheduled := func(repo *mocks.MockOrderRepo) {
+		repo.On("ScheduleRetry", mock.Anything, mock.AnythingOfType("*model.Order"), mock.Anything, mock.AnythingOfType("time.Time")).Return(nil)
+	}
+
+	tests := []struct {
+		name      string
+		resp      *accrual.AccrualResponse
+		err       error
+		mockSetup func(*mocks.MockOrderRepo)
+	}{
+		{
+			name:      "REGISTERED keeps order and releases claim",
+			resp:      &accrual.AccrualResponse{Order: workerOrderNumber, Status: "REGISTERED"},
+			mockSetup: claimReleased,
+		},
+		{
+			name:      "PROCESSING keeps order and releases claim",
+			resp:      &accrual.AccrualResponse{Order: workerOrderNumber, Status: "PROCESSING"},
+			mockSetup: claimReleased,
+		},
+		{
+			name: "PROCESSED with accrual credits user",
+			resp: &accrual.AccrualResponse{Order: workerOrderNumber, Status: "PROCESSED", Accrual: moneyPtr(50000)},
+			mockSetup: func(repo *mocks.MockOrderRepo) {
+				repo.On("MarkProcessed", mock.Anything, mock.MatchedBy(func(o *model.Order) bool {
+					return o.ID == processingOrder.ID
+				}), moneyPtr(50000)).Return(nil)
+			},
+		},
+		{
+			name: "PROCESSED without accrual",
+			resp: &accrual.AccrualResponse{Order: workerOrderNumber, Status: "PROCESSED"},
+			mockSetup: func(repo *mocks.MockOrderRepo) {
+				repo.On("MarkProcessed", mock.Anything, mock.AnythingOfType("*model.Order"), (*model.Money)(nil)).Return(nil)
+			},
+		},
+		{
+			name: "INVALID marks order invalid",
+			resp: &accrual.AccrualResponse{Order: workerOrderNumber, Status: "INVALID"},
+			mockSetup: func(repo *mocks.MockOrderRepo) {
+				repo.On("MarkInvalid", mock.Anything, mock.MatchedBy(func(o *model.Order) bool {
+					return o.ID == processingOrder.ID
+				})).Return(nil)
+			},
+		},
+		{
+			name: "unknown status recorded on order",
+			err:  fmt.Errorf("decode accrual response: %w", accrual.ErrUnknownStatus),
+			mockSetup: func(repo *mocks.MockOrderRepo) {
+				repo.On("ScheduleRetry", mock.Anything, mock.AnythingOfType("*model.Order"), mock.MatchedBy(func(reason string) bool {
+					return strings.Contains(reason, accrual.ErrUnknownStatus.Error())
+				}), mock.AnythingOfType("time.Time")).Return(nil)
+			},
+		},
+		{
+			name:      "empty status from provider schedules retry",
+			resp:      &accrual.AccrualResponse{Order: workerOrderNumber},
+			mockSetup: retryScheduled,
+		},
+		{
+			name:      "204 not registered schedules retry",
+			mockSetup: retryScheduled,
+		},
+		{
+			name:      "accrual error schedules retry",
+			err:       errors.New("connection refused"),
+			mockSetup: retryScheduled,
+		},
+		{
+			name: "rate limit keeps order",
+			err:  &accrual.RateLimitError{RetryAfter: time.Minute},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orderRepo := new(mocks.MockOrderRepo)
+			userRepo := new(mocks.MockUserRepo)
+			client := new(mocks.MockAccrualClient)
+			cfg := testOrderConfig(2)
+			svc := service.NewOrderService(orderRepo, userRepo, zap.NewNop().Sugar(), cfg)
+
+			orderRepo.On("ClaimDue", mock.Anything, model.OrderStatusProcessing, mock.Anything, mock.Anything, mock.Anything).Return([]model.Order{processingOrder}, nil)
+			client.On("GetOrderInfo", mock.Anything, workerOrderNumber).Return(tt.resp, tt.err)
+			if tt.mockSetup != nil {
+				tt.mockSetup(orderRepo)
+			}
+
+			svc.UpdateProcessingOrders(context.Background(), client, time.Second)
+
+			orderRepo.AssertExpectations(t)
+			client.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUpdateProcessingOrders_PausedAfterRateLimit(t *testing.T) {
+	orderRepo := new(mocks.MockOrderRepo)
+	client := new(mocks.MockAccrualClient)
+	svc := service.NewOrderService(orderRepo, new(mocks.MockUserRepo), zap.NewNop().Sugar(), testOrderConfig(1))
+
+	orders := []model.Order{
+		{ID: 1, Number: workerOrderNumber, Status: model.OrderStatusProcessing},
+		{ID: 2, Number: "2377225624", Status: model.OrderStatusProcessing},
+	}
+	orderRepo.On("ClaimDue", mock.Anything, model.OrderStatusProcessing, mock.Anything, mock.Anything, mock.Anything).Return(orders, nil).Once()
+	client.On("GetOrderInfo", mock.Anything, workerOrderNumber).Return(nil, &accrual.RateLimitError{RetryAfter: time.Minute}).Once()
+
+	svc.UpdateProcessingOrders(context.Background(), client, time.Second)
+	// вторая выборка не должна случиться: воркеры на паузе
+	svc.UpdateProcessingOrders(context.Background(), client, time.Second)
+
+	orderRepo.AssertExpectations(t)
+	client.AssertExpectations(t)
+	client.AssertNotCalled(t, "GetOrderInfo", mock.Anything, "2377225624")
+}
+
+func TestProcessNewOrders(t *testing.T) {
+	newOrder := model.Order{ID: 1, Number: workerOrderNumber, Status: model.OrderStatusNew, Attempts: 2, CreatedAt: time.Now()}
+
+	tests := []struct {
+		name       string
+		sendOrders bool
+		sendErr    error
+		wantUpdate bool
+	}{
+		{name: "sent and moved to PROCESSING", sendOrders: true, wantUpdate: true},
+		{name: "send failed schedules retry", sendOrders: true, sendErr: errors.New("boom")},
+		{name: "rate limited keeps NEW", sendOrders: true, sendErr: &accrual.RateLimitError{RetryAfter: time.Minute}},
+		{name: "sending disabled moves to PROCESSING", wantUpdate: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orderRepo := new(mocks.MockOrderRepo)
+			client := new(mocks.MockAccrualClient)
+			cfg := testOrderConfig(0)
+			cfg.SendOrders = tt.sendOrders
+			svc := service.NewOrderService(orderRepo, new(mocks.MockUserRepo), zap.NewNop().Sugar(), cfg)
+
+			orderRepo.On("ClaimDue", mock.Anything, model.OrderStatusNew, mock.Anything, mock.Anything, mock.Anything).Return([]model.Order{newOrder}, nil)
+			if tt.sendOrders {
+				client.On("SendOrder", mock.Anything, workerOrderNumber).Return(tt.sendErr)
+			}
+			if tt.wantUpdate {
+				orderRepo.On("MarkSent", mock.Anything, mock.MatchedBy(func(o *model.Order) bool {
+					return o.ID == newOrder.ID
+				})).Return(nil)
+			}
+			var rateErr *accrual.RateLimitError
+			if tt.sendErr != nil && !errors.As(tt.sendErr, &rateErr) {
+				orderRepo.On("ScheduleRetry", mock.Anything, mock.AnythingOfType("*model.Order"), tt.sendErr.Error(), mock.AnythingOfType("time.Time")).Return(nil)
+			}
+
+			svc.ProcessNewOrders(context.Background(), client)
+
+			orderRepo.AssertExpectations(t)
+			client.AssertExpectations(t)
+			if !tt.wantUpdate {
+				orderRepo.AssertNotCalled(t, "MarkSent", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestUpdateProcessingOrders_SkippedWhenCircuitOpen(t *testing.T) {
+	orderRepo := new(mocks.MockOrderRepo)
+	client := new(mocks.MockAccrualClient)
+	svc := service.NewOrderService(orderRepo, new(mocks.MockUserRepo), zap.NewNop().Sugar(), testOrderConfig(1))
+
+	breaker := accrual.NewBreaker(accrual.BreakerConfig{FailureThreshold: 1, Cooldown: time.Minute}, zap.NewNop().Sugar())
+	breaker.Failure()
+	provider := accrual.WithBreaker(client, breaker)
+
+	svc.UpdateProcessingOrders(context.Background(), provider, time.Second)
+	svc.ProcessNewOrders(context.Background(), provider)
+
+	orderRepo.AssertNotCalled(t, "ClaimDue", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	client.AssertNotCalled(t, "GetOrderInfo", mock.Anything, mock.Anything)
+}
+
+func TestUpdateProcessingOrders_Backoff(t *testing.T) {
+	cfg := &config.Config{
+		AccrualWorkers:   1,
+		OrderRetryBase:   time.Second,
+		OrderRetryMax:    10 * time.Second,
+		OrderMaxAttempts: 10,
+		OrderMaxAge:      time.Hour,
+	}
+
+	tests := []struct {
+		name      string
+		order     model.Order
+		wantDelay time.Duration
+		wantStuck bool
+	}{
+		{name: "first failure waits base", order: model.Order{Attempts: 0}, wantDelay: time.Second},
+		{name: "delay doubles", order: model.Order{Attempts: 2}, wantDelay: 4 * time.Second},
+		{name: "delay capped", order: model.Order{Attempts: 6}, wantDelay: 10 * time.Second},
+		{name: "attempts exhausted", order: model.Order{Attempts: 9}, wantStuck: true},
+		{name: "order too old", order: model.Order{CreatedAt: time.Now().Add(-2 * time.Hour)}, wantStuck: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orderRepo := new(mocks.MockOrderRepo)
+			client := new(mocks.MockAccrualClient)
+			svc := service.NewOrderService(orderRepo, new(mocks.MockUserRepo), zap.NewNop().Sugar(), cfg)
+
+			order := tt.order
+			order.ID = 1
+			order.Number = workerOrderNumber
+			order.Status = model.OrderStatusProcessing
+			if order.CreatedAt.IsZero() {
+				order.CreatedAt = time.Now()
+			}
+			orderRepo.On("ClaimDue", mock.Anything, model.OrderStatusProcessing, mock.Anything, mock.Anything, mock.Anything).Return([]model.Order{order}, nil)
+			client.On("GetOrderInfo", mock.Anything, workerOrderNumber).Return(nil, errors.New("boom"))
+
+			started := time.Now()
+			if tt.wantStuck {
+				orderRepo.On("MarkStuck", mock.Anything, mock.AnythingOfType("*model.Order"), "boom").Return(nil)
+			} else {
+				orderRepo.On("ScheduleRetry", mock.Anything, mock.AnythingOfType("*model.Order"), "boom", mock.MatchedBy(func(next time.Time) bool {
+					delay := next.Sub(started)
+					return delay >= tt.wantDelay && delay < tt.wantDelay+time.Second
+				})).Return(nil)
+			}
+
+			svc.UpdateProcessingOrders(context.Background(), client, time.Second)
+
+			orderRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUpdateProcessingOrders_ResendsNotRegistered(t *testing.T) {
+	tests := []struct {
+		name       string
+		sendErr    error
+		wantReason string
+	}{
+		{name: "resent", wantReason: "order was not registered in accrual, resent"},
+		{name: "resend failed", sendErr: errors.New("boom"), wantReason: "resend failed: boom"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orderRepo := new(mocks.MockOrderRepo)
+			client := new(mocks.MockAccrualClient)
+			cfg := testOrderConfig(1)
+			cfg.SendOrders = true
+			svc := service.NewOrderService(orderRepo, new(mocks.MockUserRepo), zap.NewNop().Sugar(), cfg)
+
+			order := model.Order{ID: 1, Number: workerOrderNumber, Status: model.OrderStatusProcessing, CreatedAt: time.Now()}
+			orderRepo.On("ClaimDue", mock.Anything, model.OrderStatusProcessing, mock.Anything, mock.Anything, mock.Anything).Return([]model.Order{order}, nil)
+			client.On("GetOrderInfo", mock.Anything, workerOrderNumber).Return(nil, nil)
+			client.On("SendOrder", mock.Anything, workerOrderNumber).Return(tt.sendErr)
+			orderRepo.On("ScheduleRetry", mock.Anything, mock.AnythingOfType("*model.Order"), tt.wantReason, mock.AnythingOfType("time.Time")).Return(nil)
+
+			svc.UpdateProcessingOrders(context.Background(), client, time.Second)
+
+			orderRepo.AssertExpectations(t)
+			client.AssertExpectations(t)
+		})
+	}
+}
+
+func TestProcessNewOrders_ClaimsConfiguredBatch(t *testing.T) {
+	orderRepo := new(mocks.MockOrderRepo)
+	client := new(mocks.MockAccrualClient)
+	cfg := testOrderConfig(0)
+	cfg.OrderClaimBatch, cfg.OrderClaimLease = 7, 30*time.Second
+	svc := service.NewOrderService(orderRepo, new(mocks.MockUserRepo), zap.NewNop().Sugar(), cfg)
+
+	orderRepo.On("ClaimDue", mock.Anything, model.OrderStatusNew, mock.MatchedBy(func(owner string) bool {
+		return owner != ""
+	}), 7, 30*time.Second).Return([]model.Order{}, nil)
+
+	svc.ProcessNewOrders(context.Background(), client)
+
+	orderRepo.AssertExpectations(t)
+}
+
+func TestProcessNewOrders_StopsWhenLeaseExpires(t *testing.T) {
+	orderRepo := new(mocks.MockOrderRepo)
+	client := new(mocks.MockAccrualClient)
+	cfg := testOrderConfig(0)
+	cfg.SendOrders = true
+	cfg.OrderClaimLease = 50 * time.Millisecond
+	svc := service.NewOrderService(orderRepo, new(mocks.MockUserRepo), zap.NewNop().Sugar(), cfg)
+
+	orders := []model.Order{
+		{ID: 1, Number: workerOrderNumber, Status: model.OrderStatusNew, CreatedAt: time.Now()},
+		{ID: 2, Number: "12345678903", Status: model.OrderStatusNew, CreatedAt: time.Now()},
+	}
+	orderRepo.On("ClaimDue", mock.Anything, model.OrderStatusNew, mock.Anything, mock.Anything, mock.Anything).Return(orders, nil)
+	// accrual отвечает дольше аренды: запрос обрывается дедлайном прохода
+	client.On("SendOrder", mock.Anything, workerOrderNumber).
+		Run(func(args mock.Arguments) { <-args.Get(0).(context.Context).Done() }).
+		Return(context.DeadlineExceeded).Once()
+
+	svc.ProcessNewOrders(context.Background(), client)
+
+	client.AssertNumberOfCalls(t, "SendOrder", 1)
+	orderRepo.AssertNotCalled(t, "MarkSent", mock.Anything, mock.Anything)
+	orderRepo.AssertNotCalled(t, "ScheduleRetry", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestRequeueOrder(t *testing.T) {
+	orderRepo := new(mocks.MockOrderRepo)
+	svc := service.NewOrderService(orderRepo, new(mocks.MockUserRepo), zap.NewNop().Sugar(), testOrderConfig(0))
+
+	orderRepo.On("Requeue", mock.Anything, workerOrderNumber).Return(nil)
+	orderRepo.On("Requeue", mock.Anything, "2377225624").Return(repository.ErrOrderNotStuck)
+
+	if err := svc.RequeueOrder(context.Background(), workerOrderNumber); err != nil {
+		t.Fatalf("requeue stuck order: %v", err)
+	}
+	if err := svc.RequeueOrder(context.Background(), "2377225624"); !errors.Is(err, service.ErrOrderNotStuck) {
+		t.Fatalf("expected ErrOrderNotStuck, got %v", err)
+	}
+}